@@ -0,0 +1,63 @@
+package dmod
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+)
+
+// BindForm sets the fields of the instance v from values, keys are field
+// paths such as `Name` or `Address.City`, strings are parsed by the scalars
+// of fields, unknown keys are ignored
+func (p *Model) BindForm(v interface{}, values url.Values) (err error) {
+
+	var keys []string
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field := p.Field(v, key)
+		if field == nil || !field.fieldValue.IsValid() && !field.mapValue.IsValid() {
+			continue
+		}
+
+		if err = field.SetStrings(values[key]); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// BindCSV sets the fields of the instance v from a csv record, header
+// names the field path of every column, empty cells set nullable fields to
+// null and are skipped for other fields
+func (p *Model) BindCSV(v interface{}, header, record []string) (err error) {
+
+	if len(header) != len(record) {
+		err = fmt.Errorf("record has %d columns but header has %d", len(record), len(header))
+		return
+	}
+
+	for i := 0; i < len(header); i++ {
+		if len(record[i]) == 0 {
+			if definition, exist := p.GetField(header[i]); !exist || !definition.nullable() {
+				continue
+			}
+		}
+
+		field := p.Field(v, header[i])
+		if field == nil || !field.fieldValue.IsValid() && !field.mapValue.IsValid() {
+			continue
+		}
+
+		if err = field.SetString(record[i]); err != nil {
+			return
+		}
+	}
+
+	return
+}
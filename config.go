@@ -2,81 +2,679 @@ package dmod
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 )
 
 type ModelConfig struct {
-	Name    string   `json:"name"`
-	Fields  []Field  `json:"fields,omitempty"`
-	Extends []string `json:"extends,omitempty"`
+	Name    string   `json:"name" yaml:"name" toml:"name"`
+	Fields  []Field  `json:"fields,omitempty" yaml:"fields,omitempty" toml:"fields,omitempty"`
+	Extends []string `json:"-" yaml:"-" toml:"-"`
+
+	// ExtendOptions are the extends with options, e.g. `only` or `embed`,
+	// the extends of model files are decoded into them, the names of both
+	// are merged into Extends when the model is loaded
+	ExtendOptions []Extend `json:"extends,omitempty" yaml:"extends,omitempty" toml:"extends,omitempty"`
+
+	// Abstract models are only used by extends and refs, they could not
+	// be produced
+	Abstract bool `json:"abstract,omitempty" yaml:"abstract,omitempty" toml:"abstract,omitempty"`
+	// Internal models are hidden from listings and dumps, they are still
+	// found by name
+	Internal bool `json:"internal,omitempty" yaml:"internal,omitempty" toml:"internal,omitempty"`
+	// Params makes the model a generic template, fields use the params as
+	// type names, e.g. `[]T`, and it is used as `page<user>`
+	Params []string `json:"params,omitempty" yaml:"params,omitempty" toml:"params,omitempty"`
+	// Package puts the model into a namespace, the model is named by its
+	// qualified name, e.g. `billing.address`
+	Package string `json:"package,omitempty" yaml:"package,omitempty" toml:"package,omitempty"`
+	// Imports are the packages whose models could be used by the model
+	Imports []string `json:"import,omitempty" yaml:"import,omitempty" toml:"import,omitempty"`
 
 	filepath       string
+	line           int
 	extendsUpdated bool
 
+	// template is the generic model the config is generated from
+	template string
+
 	originalFields []Field
 }
 
-func (p *ModelConfig) reset() {
-	p.Fields = p.originalFields
-	p.extendsUpdated = false
+// Source returns where the model was declared, `file:line` for models
+// of a bundle file
+func (p *ModelConfig) Source() string {
+	if p.line > 0 {
+		return p.filepath + ":" + strconv.Itoa(p.line)
+	}
+	return p.filepath
+}
 
-	for i := 0; i < len(p.Fields); i++ {
-		fieldRefReset(&p.Fields[i])
+// qualify puts the model into pkg unless it declares its own package
+func (p *ModelConfig) qualify(pkg string) {
+	if len(p.Package) == 0 {
+		p.Package = pkg
 	}
+
+	p.Name = qualifiedName(p.Package, p.Name)
+}
+
+// mergeExtends merges Extends into ExtendOptions and lists all of their names in Extends
+func (p *ModelConfig) mergeExtends() {
+	options := make(map[string]bool, len(p.ExtendOptions))
+	for _, extend := range p.ExtendOptions {
+		options[extend.Model] = true
+	}
+
+	var extends []Extend
+	for _, name := range p.Extends {
+		if !options[name] {
+			extends = append(extends, Extend{Model: name})
+		}
+	}
+
+	p.ExtendOptions = append(extends, p.ExtendOptions...)
+	p.Extends = extendNames(p.ExtendOptions)
+}
+
+// clone returns the original definition of the model sharing no fields with p
+func (p *ModelConfig) clone() ModelConfig {
+	conf := *p
+	conf.originalFields = cloneFields(p.originalFields)
+	conf.Fields = conf.originalFields
+	conf.extendsUpdated = false
+
+	return conf
 }
 
 type ModelsConfig struct {
-	Models []ModelConfig `json:"models"`
+	Models []ModelConfig         `json:"models" yaml:"models" toml:"models"`
+	Enums  map[string]EnumConfig `json:"enums,omitempty" yaml:"enums,omitempty" toml:"enums,omitempty"`
 }
 
-func modelExtendsUpdate(models map[string]*ModelConfig, model *ModelConfig) {
+type configResolver struct {
+	models map[string]*ModelConfig
+	enums  map[string]*Enum
+	names  []string
+	errs   SchemaErrors
+}
 
-	if len(model.Extends) == 0 || model.extendsUpdated {
-		return
+// configEdge is an extends or ref dependency between two models
+type configEdge struct {
+	from     string
+	path     string
+	to       string
+	extends  bool
+	nullable bool // pointer, slice or map refs could close a cycle
+	union    bool // variants of oneOf are bound at runtime, never a cycle
+	field    *Field
+}
+
+func (p configEdge) String() string {
+	if p.extends {
+		return p.from + ":extends"
+	}
+	return p.from + p.path
+}
+
+func newConfigResolver(models map[string]*ModelConfig, enums map[string]*Enum) *configResolver {
+	resolver := &configResolver{
+		models: models,
+		enums:  enums,
+	}
+
+	for name, model := range models {
+		if len(model.Params) == 0 {
+			resolver.names = append(resolver.names, name)
+		}
 	}
 
-	model.Fields = model.originalFields
+	sort.Strings(resolver.names)
 
-	for i := 0; i < len(model.Extends); i++ {
-		extendModel, exist := models[model.Extends[i]]
-		if !exist {
-			panic(fmt.Sprintf("extend model not exist, model: %s, path: %s, ref: %s ", model.Name, model.Extends[i], model.filepath))
+	return resolver
+}
+
+func resolveModelConfigs(models map[string]*ModelConfig, enums map[string]*Enum) error {
+
+	errs := qualifyModels(models)
+
+	errs = append(errs, expandGenerics(models)...)
+
+	resolver := newConfigResolver(models, enums)
+	resolver.errs = errs
+
+	graph := resolver.buildGraph()
+
+	for name, edges := range graph {
+		var bound []configEdge
+		for _, edge := range edges {
+			if !edge.union {
+				bound = append(bound, edge)
+			}
 		}
+		graph[name] = bound
+	}
+
+	resolver.detectCycles(resolver.markLateRefs(graph))
 
-		model.Fields = append(model.Fields, extendModel.Fields...)
+	if len(resolver.errs) > 0 {
+		return resolver.errs
 	}
 
-	model.extendsUpdated = true
+	for _, name := range resolver.names {
+		resolver.modelExtendsUpdate(models[name])
+	}
+
+	if len(resolver.errs) > 0 {
+		return resolver.errs
+	}
+
+	for _, name := range resolver.names {
+		model := models[name]
+		for i := 0; i < len(model.Fields); i++ {
+			resolver.fieldRefUpdate(model, &model.Fields[i])
+		}
+	}
+
+	return nil
+}
+
+// dependentModels returns names and every model depending on them
+func dependentModels(models map[string]*ModelConfig, names map[string]bool) []string {
+
+	resolver := newConfigResolver(models, nil)
+
+	dependents := map[string][]string{}
+
+	for from, edges := range resolver.buildGraph() {
+		for _, edge := range edges {
+			dependents[edge.to] = append(dependents[edge.to], from)
+		}
+	}
+
+	found := map[string]bool{}
+
+	var queue []string
+	for name := range names {
+		found[name] = true
+		queue = append(queue, name)
+	}
+
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		for _, dependent := range dependents[name] {
+			if !found[dependent] {
+				found[dependent] = true
+				queue = append(queue, dependent)
+			}
+		}
+	}
+
+	var result []string
+	for name := range found {
+		result = append(result, name)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// buildGraph collects the extends and ref edges of every model
+func (p *configResolver) buildGraph() map[string][]configEdge {
+
+	graph := map[string][]configEdge{}
+
+	for _, name := range p.names {
+		model := p.models[name]
+
+		if len(model.template) > 0 {
+			graph[name] = append(graph[name], configEdge{from: name, to: model.template, extends: true})
+		}
+
+		for i := 0; i < len(model.ExtendOptions); i++ {
+			target := canonicalName(model.ExtendOptions[i].Model)
+
+			extendModel, exist := p.models[target]
+			if !exist {
+				p.errs.add(&SchemaError{
+					Kind:   SchemaErrExtendsNotExist,
+					Model:  model.Name,
+					File:   model.filepath,
+					Line:   model.line,
+					Target: target,
+				})
+				continue
+			}
+
+			if len(extendModel.Params) > 0 {
+				p.errs.add(&SchemaError{
+					Kind:   SchemaErrInstantiate,
+					Model:  model.Name,
+					File:   model.filepath,
+					Line:   model.line,
+					Target: target,
+					Err:    fmt.Errorf("model %s is generic, use it with arguments", target),
+				})
+				continue
+			}
+
+			graph[name] = append(graph[name], configEdge{from: name, to: target, extends: true})
+		}
+
+		graph[name] = p.collectRefEdges(graph[name], model, "", model.originalFields)
+	}
+
+	return graph
+}
+
+func (p *configResolver) collectRefEdges(edges []configEdge, model *ModelConfig, parent string, fields []Field) []configEdge {
+
+	for i := 0; i < len(fields); i++ {
+		path := parent + "." + fields[i].Name
+
+		if len(fields[i].OneOf) > 0 {
+			for _, variant := range fields[i].OneOf {
+				target := canonicalName(variant)
+				if p.checkRefTarget(model, path, target) {
+					edges = append(edges, configEdge{
+						from:  model.Name,
+						path:  path,
+						to:    target,
+						union: true,
+						field: &fields[i],
+					})
+				}
+			}
+			continue
+		}
+
+		target := p.refTarget(&fields[i])
+
+		if len(target) == 0 {
+			edges = p.collectRefEdges(edges, model, path, fields[i].Children)
+			continue
+		}
+
+		if !p.checkRefTarget(model, path, target) {
+			continue
+		}
+
+		edges = append(edges, configEdge{
+			from:     model.Name,
+			path:     path,
+			to:       target,
+			nullable: isNullableRef(&fields[i]),
+			field:    &fields[i],
+		})
+	}
+
+	return edges
+}
+
+// checkRefTarget reports whether the field at path could ref target
+func (p *configResolver) checkRefTarget(model *ModelConfig, path, target string) bool {
+
+	if _, exist := p.models[target]; !exist {
+		p.errs.add(&SchemaError{
+			Kind:   SchemaErrRefNotExist,
+			Model:  model.Name,
+			Field:  path,
+			File:   model.filepath,
+			Line:   model.line,
+			Target: target,
+		})
+		return false
+	}
+
+	if len(p.models[target].Params) > 0 {
+		p.errs.add(&SchemaError{
+			Kind:   SchemaErrInstantiate,
+			Model:  model.Name,
+			Field:  path,
+			File:   model.filepath,
+			Line:   model.line,
+			Target: target,
+			Err:    fmt.Errorf("model %s is generic, use it with arguments", target),
+		})
+		return false
+	}
+
+	return true
 }
 
-func fieldRefUpdate(models map[string]*ModelConfig, model *ModelConfig, field *Field) {
+// isNullableRef reports whether the ref field is a pointer, slice or map
+func isNullableRef(field *Field) bool {
+	if field.Pointer || field.Array || field.Map {
+		return true
+	}
+
+	if len(field.Type) == 0 {
+		return false
+	}
+
+	expr, err := parseTypeExpr(field.Type)
+	if err != nil {
+		return false
+	}
+
+	return expr.kind == typeExprPtr || expr.kind == typeExprSlice || expr.kind == typeExprMap
+}
+
+// markLateRefs marks the nullable refs closing a cycle as late bound
+func (p *configResolver) markLateRefs(graph map[string][]configEdge) map[string][]configEdge {
+
+	reaches := func(from, to string) bool {
+		seen := map[string]bool{}
+		queue := []string{from}
 
-	if len(field.Ref) == 0 || field.refUpdated {
+		for len(queue) > 0 {
+			name := queue[0]
+			queue = queue[1:]
+
+			if name == to {
+				return true
+			}
+
+			for _, edge := range graph[name] {
+				if !seen[edge.to] {
+					seen[edge.to] = true
+					queue = append(queue, edge.to)
+				}
+			}
+		}
+
+		return false
+	}
+
+	late := map[*Field]bool{}
+
+	for changed := true; changed; {
+		changed = false
+
+		holdsRefs := map[string]bool{}
+
+		for holds := true; holds; {
+			holds = false
+			for name, edges := range graph {
+				if holdsRefs[name] {
+					continue
+				}
+				for _, edge := range edges {
+					if late[edge.field] || (!edge.nullable && holdsRefs[edge.to]) {
+						holdsRefs[name] = true
+						holds = true
+						break
+					}
+				}
+			}
+		}
+
+		for _, edges := range graph {
+			for _, edge := range edges {
+				if edge.extends || !edge.nullable || late[edge.field] {
+					continue
+				}
+
+				if holdsRefs[edge.to] || reaches(edge.to, edge.from) {
+					late[edge.field] = true
+					edge.field.lateRef = edge.to
+					changed = true
+				}
+			}
+		}
+	}
+
+	bound := make(map[string][]configEdge, len(graph))
+
+	for name, edges := range graph {
+		for _, edge := range edges {
+			if !late[edge.field] {
+				bound[name] = append(bound[name], edge)
+			}
+		}
+	}
+
+	return bound
+}
+
+// detectCycles reports every back edge of the graph as a cycle with its path
+func (p *configResolver) detectCycles(graph map[string][]configEdge) {
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := map[string]int{}
+
+	var stack []configEdge
+
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = visiting
+
+		for _, edge := range graph[name] {
+			switch state[edge.to] {
+			case unvisited:
+				stack = append(stack, edge)
+				visit(edge.to)
+				stack = stack[:len(stack)-1]
+			case visiting:
+				start := len(stack)
+				for start > 0 && stack[start-1].to != edge.to {
+					start--
+				}
+
+				var cycle []string
+				for _, e := range stack[start:] {
+					cycle = append(cycle, e.String())
+				}
+				cycle = append(cycle, edge.String(), edge.to)
+
+				model := p.models[edge.to]
+
+				p.errs.add(&SchemaError{
+					Kind:  SchemaErrCycle,
+					Model: model.Name,
+					File:  model.filepath,
+					Line:  model.line,
+					Cycle: cycle,
+				})
+			}
+		}
+
+		state[name] = visited
+	}
+
+	for _, name := range p.names {
+		if state[name] == unvisited {
+			visit(name)
+		}
+	}
+}
+
+// modelExtendsUpdate appends the fields of every parent to the model
+func (p *configResolver) modelExtendsUpdate(model *ModelConfig) {
+
+	if model.extendsUpdated {
 		return
 	}
 
-	refModel, exist := models[field.Ref]
-	if !exist {
-		panic(fmt.Sprintf("ref field not exist, model: %s, field: %s, path: %s, ref: %s ", model.Name, field.Name, model.filepath, field.Ref))
+	model.extendsUpdated = true
+
+	if len(model.ExtendOptions) == 0 {
+		return
 	}
 
-	field.Children = refModel.Fields
-	field.refUpdated = true
-	field.filepath = model.filepath
+	fields := make([]Field, 0, len(model.originalFields))
+	fields = append(fields, model.originalFields...)
 
-	for i := 0; i < len(field.Children); i++ {
-		fieldRefUpdate(models, model, &field.Children[i])
+	own := make(map[string]*Field, len(model.originalFields))
+	for i := 0; i < len(model.originalFields); i++ {
+		own[model.originalFields[i].Name] = &model.originalFields[i]
 	}
+
+	inherited := map[string]string{}
+
+	var embedded []Field
+
+	for i := 0; i < len(model.ExtendOptions); i++ {
+		extend := model.ExtendOptions[i]
+		extendModel := p.models[canonicalName(extend.Model)]
+
+		p.modelExtendsUpdate(extendModel)
+
+		var extendFields []Field
+		var err error
+
+		if extend.Embed && (len(extend.Only) > 0 || len(extend.Exclude) > 0) {
+			err = fmt.Errorf("only and exclude could not be used with embed")
+		} else if !extend.Embed {
+			extendFields, err = extend.filter(extendModel.Fields)
+		}
+
+		if err != nil {
+			p.errs.add(&SchemaError{
+				Kind:   SchemaErrExtends,
+				Model:  model.Name,
+				File:   model.filepath,
+				Line:   model.line,
+				Target: extend.Model,
+				Err:    err,
+			})
+			continue
+		}
+
+		// the embedded parent keeps all of its fields, so it is built as the
+		// type of the parent, own fields shadow the promoted ones as go does
+		if extend.Embed {
+			embedded = append(embedded, Field{
+				Name:      extend.embedName(extendModel.Package),
+				Anonymous: true,
+				Children:  copyFields(extendModel.Fields),
+				embed:     extend.Model,
+			})
+			continue
+		}
+
+		for _, field := range extendFields {
+			var err error
+
+			if ownField, exist := own[field.Name]; exist {
+				if ownField.Override {
+					continue
+				}
+				err = fmt.Errorf("field %s of model %s conflicts with the field inherited from %s, set override to replace it", field.Name, model.Name, extend.Model)
+			} else if from, exist := inherited[field.Name]; exist {
+				err = fmt.Errorf("field %s is inherited from both %s and %s", field.Name, from, extend.Model)
+			}
+
+			if err != nil {
+				p.errs.add(&SchemaError{
+					Kind:   SchemaErrExtends,
+					Model:  model.Name,
+					Field:  "." + field.Name,
+					File:   model.filepath,
+					Line:   model.line,
+					Target: extend.Model,
+					Err:    err,
+				})
+				continue
+			}
+
+			inherited[field.Name] = extend.Model
+
+			fields = append(fields, field)
+		}
+	}
+
+	model.Fields = append(embedded, fields...)
 }
 
-func fieldRefReset(field *Field) {
+// enumOf returns the enum named by the base name of the type of field
+func (p *configResolver) enumOf(field *Field) *Enum {
+	if len(field.Type) == 0 || len(p.enums) == 0 {
+		return nil
+	}
+
+	expr, err := parseTypeExpr(field.Type)
+	if err != nil {
+		return nil
+	}
+
+	return p.enums[expr.baseName()]
+}
+
+// refTarget returns the model referenced by Ref or by the type of field
+func (p *configResolver) refTarget(field *Field) string {
+
+	if len(field.Ref) > 0 {
+		return canonicalName(field.Ref)
+	}
+
+	if len(field.Type) == 0 {
+		return ""
+	}
+
+	expr, err := parseTypeExpr(field.Type)
+	if err != nil {
+		return ""
+	}
+
+	name := expr.baseName()
 
-	if !field.refUpdated {
+	if _, builtin := typeMap[name]; builtin {
+		return ""
+	}
+
+	if _, enum := p.enums[name]; enum {
+		return ""
+	}
+
+	if _, exist := p.models[name]; exist {
+		return name
+	}
+
+	return ""
+}
+
+func (p *configResolver) fieldRefUpdate(model *ModelConfig, field *Field) {
+
+	target := p.refTarget(field)
+
+	if len(target) == 0 {
+		field.enum = p.enumOf(field)
+
+		for i := 0; i < len(field.Children); i++ {
+			p.fieldRefUpdate(model, &field.Children[i])
+		}
 		return
 	}
 
-	field.reset()
+	if field.refUpdated {
+		return
+	}
+
+	if len(field.lateRef) > 0 {
+		field.refUpdated = true
+		field.filepath = model.filepath
+		return
+	}
+
+	refModel, exist := p.models[target]
+	if !exist {
+		return
+	}
+
+	field.Children = refModel.Fields
+	field.refUpdated = true
+	field.filepath = model.filepath
 
 	for i := 0; i < len(field.Children); i++ {
-		fieldRefReset(&field.Children[i])
+		p.fieldRefUpdate(refModel, &field.Children[i])
 	}
 }
@@ -0,0 +1,58 @@
+package dmod
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCyclePaths(t *testing.T) {
+	models, _ := NewModels()
+
+	err := models.LoadModels([]string{
+		`{"name":"user","fields":[{"name":"Manager","ref":"employee"}]}`,
+		`{"name":"employee","fields":[{"name":"Boss","ref":"user"}]}`,
+		`{"name":"a","extends":["b"]}`,
+		`{"name":"b","extends":["a"]}`,
+		`{"name":"category","fields":[{"name":"Parent","ref":"category","pointer":true}]}`,
+	})
+
+	var errs SchemaErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expect SchemaErrors, got %v", err)
+	}
+
+	want := map[string][]string{
+		"a":        {"a:extends", "b:extends", "a"},
+		"employee": {"employee.Boss", "user.Manager", "employee"},
+	}
+
+	if len(errs) != len(want) {
+		t.Fatalf("expect %d cycles, got %s", len(want), errs)
+	}
+
+	for _, e := range errs {
+		if e.Kind != SchemaErrCycle {
+			t.Errorf("unexpected error %s", e)
+			continue
+		}
+		if !reflect.DeepEqual(e.Cycle, want[e.Model]) {
+			t.Errorf("cycle of %s is %v, want %v", e.Model, e.Cycle, want[e.Model])
+		}
+	}
+
+	if _, exist := models.GetModel("category"); exist {
+		t.Errorf("failed load should not publish models")
+	}
+}
+
+func TestNullableSelfRefIsNotCycle(t *testing.T) {
+	models, _ := NewModels()
+
+	err := models.LoadModels([]string{
+		`{"name":"category","fields":[{"name":"Parent","ref":"category","pointer":true},{"name":"Children","ref":"category","array":true}]}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
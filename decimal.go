@@ -0,0 +1,332 @@
+package dmod
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// maxDecimalScale bounds exponents and scales so untrusted input could
+// not make huge numbers
+const maxDecimalScale = 4096
+
+var (
+	typeOfDecimal = reflect.TypeOf(Decimal{})
+
+	bigTen = big.NewInt(10)
+)
+
+// Decimal is an arbitrary precision decimal number, the value is
+// unscaled * 10^-scale, it is the builtin type `decimal` for money
+// columns, it is stored by databases and json as a string so no digit
+// is lost, the zero value is 0
+type Decimal struct {
+	unscaled *big.Int
+	scale    int32
+}
+
+func NewDecimal(unscaled int64, scale int32) Decimal {
+	return Decimal{unscaled: big.NewInt(unscaled), scale: scale}.normalize()
+}
+
+// ParseDecimal parses `-12.345`, `1e-3` or `+7`
+func ParseDecimal(s string) (d Decimal, err error) {
+
+	src := s
+	s = strings.TrimSpace(s)
+
+	exp := 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		exp, err = strconv.Atoi(s[i+1:])
+		if err != nil {
+			err = fmt.Errorf("invalid decimal %q", src)
+			return
+		}
+		if exp > maxDecimalScale || exp < -maxDecimalScale {
+			err = fmt.Errorf("exponent of decimal %q is out of range", src)
+			return
+		}
+		s = s[:i]
+	}
+
+	scale := 0
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		scale = len(s) - i - 1
+		s = s[:i] + s[i+1:]
+	}
+
+	if scale-exp > maxDecimalScale || scale-exp < -maxDecimalScale {
+		err = fmt.Errorf("scale of decimal %q is out of range", src)
+		return
+	}
+
+	digits := strings.TrimLeft(s, "+-")
+	if len(digits) == 0 || len(s)-len(digits) > 1 || strings.Trim(digits, "0123456789") != "" {
+		err = fmt.Errorf("invalid decimal %q", src)
+		return
+	}
+
+	unscaled, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		err = fmt.Errorf("invalid decimal %q", src)
+		return
+	}
+
+	d = Decimal{unscaled: unscaled, scale: int32(scale - exp)}.normalize()
+
+	return
+}
+
+// normalize makes the scale not negative
+func (p Decimal) normalize() Decimal {
+	if p.scale >= 0 {
+		return p
+	}
+
+	unscaled := new(big.Int).Mul(p.int(), pow10(int(-p.scale)))
+
+	return Decimal{unscaled: unscaled}
+}
+
+func (p Decimal) int() *big.Int {
+	if p.unscaled == nil {
+		return new(big.Int)
+	}
+	return p.unscaled
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+// Scale returns the digits after the decimal point
+func (p Decimal) Scale() int32 {
+	return p.scale
+}
+
+func (p Decimal) Sign() int {
+	return p.int().Sign()
+}
+
+func (p Decimal) IsZero() bool {
+	return p.Sign() == 0
+}
+
+// Rescale returns the decimal with scale digits after the decimal point,
+// extra digits are rounded half away from zero
+func (p Decimal) Rescale(scale int32) Decimal {
+
+	if scale >= p.scale {
+		unscaled := new(big.Int).Mul(p.int(), pow10(int(scale-p.scale)))
+		return Decimal{unscaled: unscaled, scale: scale}
+	}
+
+	divisor := pow10(int(p.scale - scale))
+
+	quo, rem := new(big.Int).QuoRem(p.int(), divisor, new(big.Int))
+
+	if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(divisor) >= 0 {
+		quo.Add(quo, big.NewInt(int64(p.Sign())))
+	}
+
+	return Decimal{unscaled: quo, scale: scale}
+}
+
+func (p Decimal) Add(o Decimal) Decimal {
+	a, b := align(p, o)
+	return Decimal{unscaled: new(big.Int).Add(a.int(), b.int()), scale: a.scale}
+}
+
+func (p Decimal) Sub(o Decimal) Decimal {
+	a, b := align(p, o)
+	return Decimal{unscaled: new(big.Int).Sub(a.int(), b.int()), scale: a.scale}
+}
+
+func (p Decimal) Mul(o Decimal) Decimal {
+	return Decimal{unscaled: new(big.Int).Mul(p.int(), o.int()), scale: p.scale + o.scale}
+}
+
+func (p Decimal) Neg() Decimal {
+	return Decimal{unscaled: new(big.Int).Neg(p.int()), scale: p.scale}
+}
+
+func (p Decimal) Cmp(o Decimal) int {
+	a, b := align(p, o)
+	return a.int().Cmp(b.int())
+}
+
+func align(a, b Decimal) (Decimal, Decimal) {
+	if a.scale < b.scale {
+		return a.Rescale(b.scale), b
+	}
+	return a, b.Rescale(a.scale)
+}
+
+// Rat returns the value as a big.Rat
+func (p Decimal) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(p.int(), pow10(int(p.scale)))
+}
+
+func (p Decimal) Float64() float64 {
+	f, _ := p.Rat().Float64()
+	return f
+}
+
+// digits returns the digits before and after the decimal point, trailing
+// zeros after the point are not counted
+func (p Decimal) digits() (integer, fraction int) {
+	s := new(big.Int).Abs(p.int()).String()
+
+	scale := int(p.scale)
+	for scale > 0 && strings.HasSuffix(s, "0") && len(s) > 1 {
+		s = s[:len(s)-1]
+		scale--
+	}
+
+	if s == "0" {
+		return 0, 0
+	}
+
+	integer = len(s) - scale
+	if integer < 0 {
+		integer = 0
+	}
+
+	return integer, scale
+}
+
+func (p Decimal) String() string {
+	s := new(big.Int).Abs(p.int()).String()
+
+	if p.scale > 0 {
+		if len(s) <= int(p.scale) {
+			s = strings.Repeat("0", int(p.scale)-len(s)+1) + s
+		}
+		s = s[:len(s)-int(p.scale)] + "." + s[len(s)-int(p.scale):]
+	}
+
+	if p.Sign() < 0 {
+		s = "-" + s
+	}
+
+	return s
+}
+
+func (p Decimal) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Decimal) UnmarshalText(text []byte) error {
+	return p.Scan(string(text))
+}
+
+// MarshalJSON writes the decimal as a string, e.g. `"12.30"`
+func (p Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(p.String())), nil
+}
+
+// UnmarshalJSON reads both strings and numbers, null is ignored
+func (p *Decimal) UnmarshalJSON(data []byte) (err error) {
+	data = bytes.TrimSpace(data)
+
+	if bytes.Equal(data, []byte("null")) {
+		return
+	}
+
+	s := string(data)
+
+	if len(data) > 0 && data[0] == '"' {
+		s, err = strconv.Unquote(s)
+		if err != nil {
+			return
+		}
+	}
+
+	return p.Scan(s)
+}
+
+// Scan reads strings, bytes and numbers, the decimal is unchanged on error
+func (p *Decimal) Scan(src interface{}) (err error) {
+	var d Decimal
+
+	switch v := src.(type) {
+	case string:
+		d, err = ParseDecimal(v)
+	case []byte:
+		d, err = ParseDecimal(string(v))
+	case int64:
+		d = NewDecimal(v, 0)
+	case int:
+		d = NewDecimal(int64(v), 0)
+	case float64:
+		d, err = ParseDecimal(strconv.FormatFloat(v, 'f', -1, 64))
+	case Decimal:
+		d = v
+	case nil:
+		err = fmt.Errorf("converting NULL to decimal is unsupported")
+	default:
+		err = fmt.Errorf("could not scan %T into decimal", src)
+	}
+
+	if err == nil {
+		*p = d
+	}
+
+	return
+}
+
+// Value stores the decimal as a string so no digit is lost
+func (p Decimal) Value() (driver.Value, error) {
+	return p.String(), nil
+}
+
+// checkDecimals checks every decimal of value against the precision and
+// scale of field, e.g. precision 10 and scale 2 allow 8 digits before the
+// decimal point and 2 after it
+func (p *Field) checkDecimals(value reflect.Value) (err error) {
+
+	if p.Precision <= 0 && p.Scale <= 0 || !value.IsValid() {
+		return
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !value.IsNil() {
+			err = p.checkDecimals(value.Elem())
+		}
+		return
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len() && err == nil; i++ {
+			err = p.checkDecimals(value.Index(i))
+		}
+		return
+	case reflect.Map:
+		iter := value.MapRange()
+		for iter.Next() && err == nil {
+			err = p.checkDecimals(iter.Value())
+		}
+		return
+	}
+
+	if value.Type() != typeOfDecimal {
+		return
+	}
+
+	d := value.Interface().(Decimal)
+
+	integer, fraction := d.digits()
+
+	if fraction > p.Scale {
+		return fmt.Errorf("decimal %s has more than %d digits after the decimal point", d, p.Scale)
+	}
+
+	if p.Precision > 0 && integer > p.Precision-p.Scale {
+		return fmt.Errorf("decimal %s has more than %d digits before the decimal point", d, p.Precision-p.Scale)
+	}
+
+	return
+}
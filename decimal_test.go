@@ -0,0 +1,114 @@
+package dmod
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseDecimal(t *testing.T) {
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"-12.345", "-12.345"},
+		{"+7", "7"},
+		{"1e-3", "0.001"},
+		{"1.5e2", "150"},
+		{"0.10", "0.10"},
+		{".5", "0.5"},
+	}
+
+	for _, c := range cases {
+		d, err := ParseDecimal(c.src)
+		if err != nil {
+			t.Fatalf("parse %q, %s", c.src, err)
+		}
+		if d.String() != c.want {
+			t.Errorf("parse %q, got %s, want %s", c.src, d, c.want)
+		}
+	}
+
+	for _, src := range []string{"", "-", "1.2.3", "--1", "1e", "abc", "1e5000", "1e-5000", "1e50000000"} {
+		start := time.Now()
+		if _, err := ParseDecimal(src); err == nil {
+			t.Errorf("parse %q, expect error", src)
+		}
+		if time.Since(start) > time.Second {
+			t.Errorf("parse %q took %s", src, time.Since(start))
+		}
+	}
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	d := func(s string) Decimal {
+		v, err := ParseDecimal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	cases := []struct {
+		got  Decimal
+		want string
+	}{
+		{d("1.10").Add(d("2.205")), "3.305"},
+		{d("1").Sub(d("0.01")), "0.99"},
+		{d("-1.5").Mul(d("2.5")), "-3.75"},
+		{d("2.345").Rescale(2), "2.35"},
+		{d("-2.345").Rescale(2), "-2.35"},
+		{d("2.344").Rescale(2), "2.34"},
+		{d("1.2").Rescale(3), "1.200"},
+		{d("3").Neg(), "-3"},
+	}
+
+	for i, c := range cases {
+		if c.got.String() != c.want {
+			t.Errorf("case %d, got %s, want %s", i, c.got, c.want)
+		}
+	}
+
+	if d("1.0").Cmp(d("1")) != 0 || d("0.99").Cmp(d("1")) != -1 {
+		t.Errorf("unexpected comparison")
+	}
+
+	var zero Decimal
+	if !zero.IsZero() || zero.String() != "0" {
+		t.Errorf("unexpected zero value %s", zero)
+	}
+}
+
+func TestDecimalJSON(t *testing.T) {
+	var v Decimal
+
+	for _, src := range []string{`"12.30"`, `12.30`} {
+		if err := v.UnmarshalJSON([]byte(src)); err != nil {
+			t.Fatal(err)
+		}
+		if v.String() != "12.30" {
+			t.Errorf("unmarshal %s, got %s", src, v)
+		}
+	}
+
+	data, _ := v.MarshalJSON()
+	if string(data) != `"12.30"` {
+		t.Errorf("marshal got %s", data)
+	}
+
+	if err := v.UnmarshalJSON([]byte(`"1e99999999"`)); err == nil {
+		t.Errorf("expect error for huge exponent")
+	}
+}
+
+func TestCheckDecimals(t *testing.T) {
+	field := &Field{Name: "Amount", Precision: 5, Scale: 2}
+
+	for src, ok := range map[string]bool{"123.45": true, "123.4": true, "1234.5": false, "1.234": false, "1.230": true} {
+		d, _ := ParseDecimal(src)
+		err := field.checkDecimals(reflect.ValueOf(d))
+		if (err == nil) != ok {
+			t.Errorf("check %s, got %v", src, err)
+		}
+	}
+}
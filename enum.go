@@ -0,0 +1,248 @@
+package dmod
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// EnumConfig declares an enumeration over a builtin type, it is declared
+// under `enums` of a model file and used by name as Field.Type, e.g.
+// `{"enums": {"status": {"type": "string", "values": ["active", "disabled"]}}}`
+type EnumConfig struct {
+	Type   string        `json:"type" yaml:"type" toml:"type"`
+	Values []interface{} `json:"values" yaml:"values" toml:"values"`
+
+	name     string
+	filepath string
+}
+
+// Enum is a built enumeration, Type is the base type of the fields
+type Enum struct {
+	name   string
+	typ    reflect.Type
+	values []interface{}
+	config EnumConfig
+}
+
+func newEnum(name string, config EnumConfig, lookup func(name string) (reflect.Type, bool)) (enum *Enum, err error) {
+
+	typ, exist := lookup(config.Type)
+	if !exist {
+		err = fmt.Errorf("type %s not register", config.Type)
+		return
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+	default:
+		err = fmt.Errorf("type %s could not be enum", config.Type)
+		return
+	}
+
+	if len(config.Values) == 0 {
+		err = fmt.Errorf("values is empty")
+		return
+	}
+
+	enum = &Enum{
+		name:   name,
+		typ:    typ,
+		config: config,
+	}
+
+	for _, value := range config.Values {
+		v, ok := enum.convert(reflect.ValueOf(value))
+		if !ok || !reflect.DeepEqual(v.Convert(reflect.TypeOf(value)).Interface(), value) {
+			enum = nil
+			err = fmt.Errorf("value %v could not be %s", value, config.Type)
+			return
+		}
+
+		enum.values = append(enum.values, v.Interface())
+	}
+
+	return
+}
+
+func (p *Enum) Name() string {
+	return p.name
+}
+
+// Type returns the base type, e.g. string
+func (p *Enum) Type() reflect.Type {
+	return p.typ
+}
+
+// Values returns the values converted to the base type
+func (p *Enum) Values() []interface{} {
+	return append([]interface{}{}, p.values...)
+}
+
+func (p *Enum) Config() EnumConfig {
+	return p.config
+}
+
+// Contains reports whether value is one of the values
+func (p *Enum) Contains(value interface{}) bool {
+	reflectValue, ok := value.(reflect.Value)
+	if !ok {
+		reflectValue = reflect.ValueOf(value)
+	}
+
+	v, ok := p.convert(reflectValue)
+	if !ok {
+		return false
+	}
+
+	for _, enumValue := range p.values {
+		if v.Interface() == enumValue {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate checks value, or every element of a pointer, slice, array or
+// map value, only nil pointers and invalid sql.Null values are unset, zero
+// values must be one of the values too
+func (p *Enum) Validate(value interface{}) (err error) {
+	reflectValue, ok := value.(reflect.Value)
+	if !ok {
+		reflectValue = reflect.ValueOf(value)
+	}
+
+	if !reflectValue.IsValid() {
+		return
+	}
+
+	if sqlNullValueTypes[reflectValue.Type()] {
+		reflectValue, _ = nullValue(reflectValue)
+		return p.Validate(reflectValue)
+	}
+
+	switch reflectValue.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if reflectValue.IsNil() {
+			return
+		}
+		return p.Validate(reflectValue.Elem())
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < reflectValue.Len(); i++ {
+			if err = p.Validate(reflectValue.Index(i)); err != nil {
+				return
+			}
+		}
+		return
+	case reflect.Map:
+		iter := reflectValue.MapRange()
+		for iter.Next() {
+			if err = p.Validate(iter.Value()); err != nil {
+				return
+			}
+		}
+		return
+	}
+
+	if !p.Contains(reflectValue) {
+		err = fmt.Errorf("value %v is not one of enum %s %v", reflectValue.Interface(), p.name, p.values)
+	}
+
+	return
+}
+
+// convert converts v to the base type, numbers are never converted to
+// strings
+func (p *Enum) convert(v reflect.Value) (reflect.Value, bool) {
+	if !v.IsValid() || !v.Type().ConvertibleTo(p.typ) {
+		return reflect.Value{}, false
+	}
+
+	if (p.typ.Kind() == reflect.String) != (v.Kind() == reflect.String) {
+		return reflect.Value{}, false
+	}
+
+	return v.Convert(p.typ), true
+}
+
+// buildEnums builds every enum config, the errors of all of them are
+// collected into SchemaErrors
+func buildEnums(configs map[string]*EnumConfig, lookup func(name string) (reflect.Type, bool)) (enums map[string]*Enum, err error) {
+
+	var names []string
+	for name := range configs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	built := make(map[string]*Enum, len(configs))
+
+	var errs SchemaErrors
+
+	for _, name := range names {
+		config := configs[name]
+
+		enum, buildErr := newEnum(name, *config, lookup)
+		if buildErr != nil {
+			errs.add(&SchemaError{
+				Kind:   SchemaErrEnum,
+				File:   config.filepath,
+				Target: name,
+				Err:    buildErr,
+			})
+			continue
+		}
+
+		built[name] = enum
+	}
+
+	if len(errs) > 0 {
+		err = errs
+		return
+	}
+
+	enums = built
+
+	return
+}
+
+// usedEnums collects the enums of fields, fields of refs are skipped
+// because their enums belong to the referenced models
+func usedEnums(fields []Field, enums map[string]*Enum) map[string]*Enum {
+	if enums == nil {
+		enums = map[string]*Enum{}
+	}
+
+	for i := 0; i < len(fields); i++ {
+		if fields[i].enum != nil {
+			enums[fields[i].enum.name] = fields[i].enum
+		}
+
+		if !fields[i].refUpdated {
+			usedEnums(fields[i].Children, enums)
+		}
+	}
+
+	return enums
+}
+
+func sortedEnums(enums map[string]*Enum) []*Enum {
+	var names []string
+	for name := range enums {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var sorted []*Enum
+	for _, name := range names {
+		sorted = append(sorted, enums[name])
+	}
+
+	return sorted
+}
@@ -0,0 +1,79 @@
+package dmod
+
+import (
+	"testing"
+)
+
+func TestEnumValues(t *testing.T) {
+	models, _ := NewModels(ModelsOptNullStrategy(NullSQL))
+
+	err := models.LoadModels([]string{`{
+		"enums": {
+			"status": {"type": "string", "values": ["active", "disabled"]},
+			"level": {"type": "int", "values": [1, 2]}
+		},
+		"name": "account",
+		"fields": [
+			{"name": "Status", "type": "status"},
+			{"name": "Level", "type": "level"},
+			{"name": "Prev", "type": "status", "nullable": true},
+			{"name": "Tags", "type": "[]status"}
+		]
+	}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account, _ := models.GetModel("account")
+
+	v := account.New()
+
+	sets := []struct {
+		path  string
+		value interface{}
+		ok    bool
+	}{
+		{"Status", "active", true},
+		{"Status", "", false},
+		{"Status", "deleted", false},
+		{"Level", 2, true},
+		{"Level", 0, false},
+		{"Level", 3, false},
+		{"Prev", nil, true},
+		{"Prev", "disabled", true},
+		{"Prev", "", false},
+		{"Tags", []string{"active"}, true},
+		{"Tags", []string{"active", ""}, false},
+	}
+
+	for _, c := range sets {
+		err = account.Field(v, c.path).Set(c.value)
+		if (err == nil) != c.ok {
+			t.Errorf("set %s to %#v got %v", c.path, c.value, err)
+		}
+	}
+
+	if err = account.Validate(v); err != nil {
+		t.Errorf("validate a valid instance got %v", err)
+	}
+
+	if err = account.Validate(account.New()); err == nil {
+		t.Error("expect zero values out of the enums rejected")
+	}
+
+	decodes := map[string]bool{
+		`{"Status":"active","Level":1}`:                 true,
+		`{"Status":"active","Level":1,"Prev":null}`:     true,
+		`{"Status":"","Level":1}`:                       false,
+		`{"Status":"active","Level":0}`:                 false,
+		`{"Level":1}`:                                   false,
+		`{"Status":"active","Level":1,"Prev":""}`:       false,
+		`{"Status":"active","Level":1,"Tags":["nope"]}`: false,
+	}
+
+	for data, ok := range decodes {
+		if _, err = account.Decode([]byte(data)); (err == nil) != ok {
+			t.Errorf("decode %s got %v", data, err)
+		}
+	}
+}
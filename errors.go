@@ -0,0 +1,102 @@
+package dmod
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type SchemaErrorKind string
+
+const (
+	SchemaErrRefNotExist     SchemaErrorKind = "ref not exist"
+	SchemaErrExtendsNotExist SchemaErrorKind = "extend model not exist"
+	SchemaErrCycle           SchemaErrorKind = "cycle detected"
+	SchemaErrBuild           SchemaErrorKind = "build model failed"
+	SchemaErrDecode          SchemaErrorKind = "decode model failed"
+	SchemaErrEnum            SchemaErrorKind = "build enum failed"
+	SchemaErrName            SchemaErrorKind = "invalid field name"
+	SchemaErrExtends         SchemaErrorKind = "extend model failed"
+	SchemaErrInstantiate     SchemaErrorKind = "instantiate model failed"
+	SchemaErrImport          SchemaErrorKind = "import package failed"
+	SchemaErrDuplicate       SchemaErrorKind = "model defined twice"
+)
+
+// SchemaError describes a single problem found in a model definition,
+// Field is the dotted path of the field inside the model, e.g. `.Address.City`
+type SchemaError struct {
+	Kind   SchemaErrorKind
+	Model  string
+	Field  string
+	File   string
+	Line   int
+	Target string
+	Cycle  []string
+	Err    error
+}
+
+func (p *SchemaError) Error() string {
+	var items []string
+
+	if len(p.Model) > 0 {
+		items = append(items, "model: "+p.Model)
+	}
+
+	if len(p.Field) > 0 {
+		items = append(items, "field: "+p.Field)
+	}
+
+	if len(p.File) > 0 {
+		items = append(items, "path: "+p.File)
+	}
+
+	if p.Line > 0 {
+		items = append(items, "line: "+strconv.Itoa(p.Line))
+	}
+
+	if len(p.Target) > 0 {
+		items = append(items, "target: "+p.Target)
+	}
+
+	if len(p.Cycle) > 0 {
+		items = append(items, "cycle: "+strings.Join(p.Cycle, " -> "))
+	}
+
+	if p.Err != nil {
+		items = append(items, "error: "+p.Err.Error())
+	}
+
+	return fmt.Sprintf("%s, %s", p.Kind, strings.Join(items, ", "))
+}
+
+func (p *SchemaError) Unwrap() error {
+	return p.Err
+}
+
+// SchemaErrors aggregates every problem found while loading models
+type SchemaErrors []*SchemaError
+
+func (p SchemaErrors) Error() string {
+	if len(p) == 1 {
+		return p[0].Error()
+	}
+
+	var lines []string
+	for i := 0; i < len(p); i++ {
+		lines = append(lines, p[i].Error())
+	}
+
+	return fmt.Sprintf("%d schema errors:\n\t%s", len(p), strings.Join(lines, "\n\t"))
+}
+
+func (p SchemaErrors) Unwrap() []error {
+	var errs []error
+	for i := 0; i < len(p); i++ {
+		errs = append(errs, p[i])
+	}
+	return errs
+}
+
+func (p *SchemaErrors) add(err *SchemaError) {
+	*p = append(*p, err)
+}
@@ -0,0 +1,59 @@
+package dmod
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSchemaErrors(t *testing.T) {
+	models, _ := NewModels()
+
+	err := models.LoadModels([]string{
+		`{"name":"user","fields":[{"name":"Home","ref":"address"},{"name":"Work","ref":"office"}]}`,
+		`{"name":"post","extends":["base"],"fields":[{"name":"Title","type":"string"}]}`,
+	})
+
+	var errs SchemaErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expect SchemaErrors, got %v", err)
+	}
+
+	var got []string
+	for _, e := range errs {
+		got = append(got, string(e.Kind)+" "+e.Model+e.Field+" "+e.Target)
+	}
+
+	sort.Strings(got)
+
+	want := []string{
+		"extend model not exist post base",
+		"ref not exist user.Home address",
+		"ref not exist user.Work office",
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got errors\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if _, exist := models.GetModel("post"); exist {
+		t.Error("a failed load should publish nothing")
+	}
+}
+
+func TestNewModelBuildError(t *testing.T) {
+	models, _ := NewModels()
+
+	_, err := models.NewModel(ModelConfig{Name: "user", Fields: []Field{{Name: "Home", Type: "nope"}}})
+
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) || schemaErr.Kind != SchemaErrBuild || schemaErr.Model != "user" {
+		t.Errorf("expect a build SchemaError, got %v", err)
+	}
+
+	_, err = models.SetModel(ModelConfig{Name: "user", Fields: []Field{{Name: "Home", Type: "nope"}}})
+	if !errors.As(err, &schemaErr) || schemaErr.Kind != SchemaErrBuild {
+		t.Errorf("expect a build SchemaError, got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package dmod
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Extend is an entry of ModelConfig.ExtendOptions, it is the name of the parent
+// model, or an object choosing the fields to inherit, e.g.
+// `{"model": "gorm.model", "exclude": ["DeletedAt"]}`, Only keeps the
+// listed fields and Exclude drops them, Embed embeds the parent as an
+// anonymous struct field named by PascalCase, e.g. `GormModel`, instead
+// of copying its fields
+type Extend struct {
+	Model   string   `json:"model" yaml:"model" toml:"model"`
+	Only    []string `json:"only,omitempty" yaml:"only,omitempty" toml:"only,omitempty"`
+	Exclude []string `json:"exclude,omitempty" yaml:"exclude,omitempty" toml:"exclude,omitempty"`
+	Embed   bool     `json:"embed,omitempty" yaml:"embed,omitempty" toml:"embed,omitempty"`
+}
+
+type extendObject Extend
+
+func extendNames(extends []Extend) (names []string) {
+	for _, extend := range extends {
+		names = append(names, extend.Model)
+	}
+	return
+}
+
+func (p Extend) simple() bool {
+	return len(p.Only) == 0 && len(p.Exclude) == 0 && !p.Embed
+}
+
+// embedName is the name of the embedded field of the parent, the package
+// pkg of the parent is not part of it
+func (p Extend) embedName(pkg string) string {
+	if len(pkg) > 0 {
+		return PascalCase(strings.TrimPrefix(p.Model, pkg+"."))
+	}
+	return PascalCase(p.Model)
+}
+
+func (p Extend) MarshalJSON() ([]byte, error) {
+	if p.simple() {
+		return json.Marshal(p.Model)
+	}
+	return json.Marshal(extendObject(p))
+}
+
+func (p *Extend) UnmarshalJSON(data []byte) error {
+	if strings.HasPrefix(strings.TrimSpace(string(data)), `"`) {
+		*p = Extend{}
+		return json.Unmarshal(data, &p.Model)
+	}
+	return json.Unmarshal(data, (*extendObject)(p))
+}
+
+func (p Extend) MarshalYAML() (interface{}, error) {
+	if p.simple() {
+		return p.Model, nil
+	}
+	return extendObject(p), nil
+}
+
+func (p *Extend) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*p = Extend{}
+		return node.Decode(&p.Model)
+	}
+	return node.Decode((*extendObject)(p))
+}
+
+func (p *Extend) UnmarshalTOML(data interface{}) (err error) {
+	*p = Extend{}
+
+	switch v := data.(type) {
+	case string:
+		p.Model = v
+	case map[string]interface{}:
+		for key, value := range v {
+			switch key {
+			case "model":
+				p.Model, _ = value.(string)
+			case "only":
+				p.Only, err = tomlStrings(key, value)
+			case "exclude":
+				p.Exclude, err = tomlStrings(key, value)
+			case "embed":
+				var ok bool
+				if p.Embed, ok = value.(bool); !ok {
+					err = fmt.Errorf("embed of extends must be a bool")
+				}
+			default:
+				err = fmt.Errorf("unknown key %s of extends", key)
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	default:
+		err = fmt.Errorf("extends entry must be a string or a table, got %T", data)
+	}
+
+	return
+}
+
+func tomlStrings(key string, value interface{}) ([]string, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s of extends must be an array of strings", key)
+	}
+
+	var strs []string
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s of extends must be an array of strings", key)
+		}
+		strs = append(strs, s)
+	}
+
+	return strs, nil
+}
+
+// filter returns the fields of the parent kept by Only and Exclude, the
+// names must be fields of the parent
+func (p Extend) filter(fields []Field) (filtered []Field, err error) {
+
+	names := make(map[string]bool, len(fields))
+	for i := 0; i < len(fields); i++ {
+		names[fields[i].Name] = true
+	}
+
+	only := make(map[string]bool, len(p.Only))
+	exclude := make(map[string]bool, len(p.Exclude))
+
+	for _, name := range p.Only {
+		if !names[name] {
+			return nil, fmt.Errorf("field %s of only not found in model %s", name, p.Model)
+		}
+		only[name] = true
+	}
+
+	for _, name := range p.Exclude {
+		if !names[name] {
+			return nil, fmt.Errorf("field %s of exclude not found in model %s", name, p.Model)
+		}
+		exclude[name] = true
+	}
+
+	for i := 0; i < len(fields); i++ {
+		if len(only) > 0 && !only[fields[i].Name] || exclude[fields[i].Name] {
+			continue
+		}
+		filtered = append(filtered, fields[i])
+	}
+
+	return
+}
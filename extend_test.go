@@ -0,0 +1,138 @@
+package dmod
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtendEmbed(t *testing.T) {
+	models, _ := NewModels()
+
+	err := models.LoadModels([]string{
+		`{"name":"base","abstract":true,"fields":[{"name":"ID","type":"int"},{"name":"Name","type":"string"}]}`,
+		`{"name":"post","extends":[{"model":"base","embed":true}],"fields":[{"name":"Name","type":"string"},{"name":"Title","type":"string"}]}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base, _ := models.GetModel("base")
+	post, _ := models.GetModel("post")
+
+	embedded := post.Type().Field(0)
+	if !embedded.Anonymous || embedded.Name != "Base" || embedded.Type != base.Type() {
+		t.Fatalf("expect the type of base embedded, got %s %s", embedded.Name, embedded.Type)
+	}
+
+	v := post.New()
+
+	if err = post.Field(v, "ID").Set(3); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = post.Field(v, "Name").Set("own"); err != nil {
+		t.Fatal(err)
+	}
+
+	st := reflect.ValueOf(v).Elem()
+	if st.Field(0).Field(0).Int() != 3 {
+		t.Errorf("promoted field not set, got %v", st.Field(0).Interface())
+	}
+
+	if st.FieldByName("Name").String() != "own" || st.Field(0).FieldByName("Name").String() != "" {
+		t.Errorf("own field should shadow the promoted one, got %+v", st.Interface())
+	}
+
+	parent := reflect.New(base.Type()).Elem()
+	parent.Set(st.Field(0))
+
+	err = models.LoadModels([]string{
+		`{"name":"draft","extends":[{"model":"base","embed":true,"only":["ID"]}]}`,
+	})
+	if err == nil {
+		t.Error("expect only with embed rejected")
+	}
+}
+
+func TestExtendFields(t *testing.T) {
+	models, _ := NewModels()
+
+	err := models.LoadModels([]string{
+		`{"name":"base","abstract":true,"fields":[{"name":"ID","type":"int"},{"name":"CreatedAt","type":"time.Time"},{"name":"DeletedAt","type":"*time.Time"}]}`,
+		`{"name":"audit","abstract":true,"fields":[{"name":"By","type":"string"},{"name":"At","type":"time.Time"}]}`,
+		`{"name":"post","extends":["audit",{"model":"base","exclude":["DeletedAt"]}],"fields":[{"name":"ID","type":"string","override":true}]}`,
+		`{"name":"note","extends":[{"model":"audit","only":["By"]}]}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := func(name string) (fields []string) {
+		model, _ := models.GetModel(name)
+		for i := 0; i < model.Type().NumField(); i++ {
+			fields = append(fields, model.Type().Field(i).Name+" "+model.Type().Field(i).Type.String())
+		}
+		return
+	}
+
+	if got := strings.Join(names("post"), ", "); got != "ID string, By string, At time.Time, CreatedAt time.Time" {
+		t.Errorf("unexpected fields of post, %s", got)
+	}
+
+	if got := strings.Join(names("note"), ", "); got != "By string" {
+		t.Errorf("unexpected fields of note, %s", got)
+	}
+
+	post, _ := models.GetModel("post")
+
+	var dumped ModelConfig
+	if err = json.Unmarshal([]byte(post.Dump()), &dumped); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(dumped.ExtendOptions, []Extend{{Model: "audit"}, {Model: "base", Exclude: []string{"DeletedAt"}}}) {
+		t.Errorf("extends not dumped, %s", post.Dump())
+	}
+
+	cases := map[string]string{
+		`{"name":"bad","extends":["base"],"fields":[{"name":"ID","type":"string"}]}`:       "field ID of model bad conflicts with the field inherited from base",
+		`{"name":"bad","extends":["base",{"model":"base","only":["ID"]}]}`:                 "field ID is inherited from both base and base",
+		`{"name":"bad","extends":[{"model":"base","only":["Nope"]}]}`:                      "field Nope of only not found in model base",
+		`{"name":"bad","extends":[{"model":"base","exclude":["Nope"]}]}`:                   "field Nope of exclude not found in model base",
+		`{"name":"bad","extends":[{"model":"base","embed":true,"exclude":["DeletedAt"]}]}`: "only and exclude could not be used with embed",
+	}
+
+	for schema, want := range cases {
+		err = models.LoadModels([]string{schema})
+
+		var errs SchemaErrors
+		if !errors.As(err, &errs) || errs[0].Kind != SchemaErrExtends || !strings.Contains(err.Error(), want) {
+			t.Errorf("load %s got %v, want %q", schema, err, want)
+		}
+	}
+}
+
+func TestExtendsOfConfig(t *testing.T) {
+	models, _ := NewModels()
+
+	err := models.LoadModels([]string{`{"name":"base","fields":[{"name":"ID","type":"int"}]}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	model, err := models.NewModel(ModelConfig{
+		Name:    "post",
+		Extends: []string{"base"},
+		Fields:  []Field{{Name: "Title", Type: "string"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, exist := model.GetField(".ID"); !exist {
+		t.Errorf("extends of the config not inherited, %s", model.Type())
+	}
+}
@@ -0,0 +1,280 @@
+package dmod
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxGenericDepth limits nested instantiations, so a template holding
+// `wrap<wrap<T>>` could not instantiate itself forever
+const maxGenericDepth = 8
+
+// canonicalName renders a generic name in its canonical form, e.g.
+// `pair< user, order >` is `pair<user,order>`, other names are returned
+// as they are
+func canonicalName(name string) string {
+	if !strings.Contains(name, "<") {
+		return name
+	}
+
+	expr, err := parseTypeExpr(name)
+	if err != nil {
+		return name
+	}
+
+	return expr.String()
+}
+
+// instanceName returns the canonical name of the instantiation of
+// template by args
+func instanceName(template string, args ...string) (name string, err error) {
+	name = template + "<" + strings.Join(args, ",") + ">"
+
+	expr, err := parseTypeExpr(name)
+	if err != nil {
+		return
+	}
+
+	name = expr.String()
+
+	return
+}
+
+// genericNames collects the canonical generic names used by the types,
+// refs, union variants and extends of a model
+func genericNames(fields []Field, extends []Extend, names []string) []string {
+
+	collect := func(src string) {
+		if !strings.Contains(src, "<") {
+			return
+		}
+
+		expr, err := parseTypeExpr(src)
+		if err != nil {
+			return
+		}
+
+		expr.eachGeneric(func(generic *typeExpr) {
+			names = append(names, generic.String())
+		})
+	}
+
+	for i := 0; i < len(extends); i++ {
+		collect(extends[i].Model)
+	}
+
+	for i := 0; i < len(fields); i++ {
+		collect(fields[i].Type)
+		collect(fields[i].Ref)
+		for _, variant := range fields[i].OneOf {
+			collect(variant)
+		}
+		names = genericNames(fields[i].Children, nil, names)
+	}
+
+	return names
+}
+
+// expandGenerics adds a config for every instantiation of a generic model
+// used by models, e.g. `page<user>`, the fields of the template are copied
+// with its params replaced by the arguments, generated configs are
+// generated again from their templates, so they follow the templates
+func expandGenerics(models map[string]*ModelConfig) (errs SchemaErrors) {
+
+	var queue []string
+
+	var names []string
+	for name := range models {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		model := models[name]
+
+		if len(model.template) > 0 {
+			delete(models, name)
+			queue = append(queue, name)
+			continue
+		}
+
+		if len(model.Params) == 0 {
+			queue = genericNames(model.originalFields, model.ExtendOptions, queue)
+		}
+	}
+
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		if _, exist := models[name]; exist {
+			continue
+		}
+
+		instance, err := instantiateConfig(models, name)
+		if err != nil {
+			errs.add(err)
+			continue
+		}
+
+		if instance == nil {
+			continue
+		}
+
+		models[name] = instance
+
+		queue = genericNames(instance.originalFields, instance.ExtendOptions, queue)
+	}
+
+	return
+}
+
+// instantiateConfig generates the config of the generic name, it is nil
+// when the template does not exist, which is reported as a missing ref
+func instantiateConfig(models map[string]*ModelConfig, name string) (instance *ModelConfig, schemaErr *SchemaError) {
+
+	expr, err := parseTypeExpr(name)
+	if err != nil || expr.kind != typeExprName || len(expr.args) == 0 {
+		return
+	}
+
+	template, exist := models[expr.name]
+	if !exist {
+		return
+	}
+
+	newErr := func(err error) *SchemaError {
+		return &SchemaError{
+			Kind:   SchemaErrInstantiate,
+			Model:  name,
+			File:   template.filepath,
+			Line:   template.line,
+			Target: template.Name,
+			Err:    err,
+		}
+	}
+
+	if len(template.Params) == 0 {
+		schemaErr = newErr(fmt.Errorf("model %s is not generic", template.Name))
+		return
+	}
+
+	if len(template.Params) != len(expr.args) {
+		schemaErr = newErr(fmt.Errorf("model %s expects %d arguments, got %d", template.Name, len(template.Params), len(expr.args)))
+		return
+	}
+
+	if strings.Count(name, "<") > maxGenericDepth {
+		schemaErr = newErr(fmt.Errorf("instantiation is nested deeper than %d", maxGenericDepth))
+		return
+	}
+
+	params := make(map[string]*typeExpr, len(template.Params))
+	for i := 0; i < len(template.Params); i++ {
+		params[template.Params[i]] = expr.args[i]
+	}
+
+	instance = &ModelConfig{
+		Name:     name,
+		Fields:   substituteFields(cloneFields(template.originalFields), params),
+		Internal: template.Internal,
+		Package:  template.Package,
+		filepath: template.filepath,
+		line:     template.line,
+		template: template.Name,
+	}
+
+	for _, extend := range template.ExtendOptions {
+		extend.Model = substituteName(extend.Model, params)
+		instance.ExtendOptions = append(instance.ExtendOptions, extend)
+	}
+
+	instance.Extends = extendNames(instance.ExtendOptions)
+
+	instance.originalFields = instance.Fields
+
+	return
+}
+
+// substituteName replaces the params in a type expression or a model name
+func substituteName(src string, params map[string]*typeExpr) string {
+	if len(src) == 0 {
+		return src
+	}
+
+	expr, err := parseTypeExpr(src)
+	if err != nil {
+		return src
+	}
+
+	return expr.substitute(params).String()
+}
+
+func substituteFields(fields []Field, params map[string]*typeExpr) []Field {
+	for i := 0; i < len(fields); i++ {
+		fields[i].Type = substituteName(fields[i].Type, params)
+		fields[i].Ref = substituteName(fields[i].Ref, params)
+
+		if len(fields[i].OneOf) > 0 {
+			variants := make([]string, len(fields[i].OneOf))
+			for j, variant := range fields[i].OneOf {
+				variants[j] = substituteName(variant, params)
+			}
+			fields[i].OneOf = variants
+		}
+
+		fields[i].Children = substituteFields(fields[i].Children, params)
+	}
+
+	return fields
+}
+
+// Instantiate returns the instance of the generic model template by args,
+// e.g. Instantiate("page", "user") is the model `page<user>`, instances
+// are cached as models of their canonical names
+func (p *Models) Instantiate(template string, args ...string) (model *Model, err error) {
+
+	name, err := instanceName(template, args...)
+	if err != nil {
+		return
+	}
+
+	if model, exist := p.GetModel(name); exist {
+		return model, nil
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	current := p.Snapshot()
+
+	if model, exist := current.GetModel(name); exist {
+		return model, nil
+	}
+
+	allModels := current.copyModelsConfig()
+
+	instance, schemaErr := instantiateConfig(allModels, name)
+	if schemaErr != nil {
+		err = schemaErr
+		return
+	}
+
+	if instance == nil {
+		err = fmt.Errorf("generic model %s not exist", template)
+		return
+	}
+
+	allModels[name] = instance
+
+	err = p.commitModels(allModels, current.copyEnumsConfig())
+	if err != nil {
+		return
+	}
+
+	model, _ = p.Snapshot().GetModel(name)
+
+	return
+}
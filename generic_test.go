@@ -0,0 +1,74 @@
+package dmod
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestInstantiate(t *testing.T) {
+	models, _ := NewModels()
+
+	err := models.LoadModels([]string{
+		`{"name":"user","fields":[{"name":"Name","type":"string"}]}`,
+		`{"name":"page","params":["T"],"fields":[{"name":"Items","type":"[]T"},{"name":"Total","type":"int"}]}`,
+		`{"name":"listing","fields":[{"name":"Users","ref":"page< user >"}]}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, exist := models.GetModel("page"); exist {
+		t.Error("template should not be built")
+	}
+
+	implicit, exist := models.GetModel("page<user>")
+	if !exist {
+		t.Fatal("page<user> should be instantiated by listing")
+	}
+
+	model, err := models.Instantiate("page", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if model != implicit {
+		t.Error("Instantiate should return the cached instance")
+	}
+
+	again, err := models.Instantiate("page", " user")
+	if err != nil || again != model {
+		t.Errorf("second Instantiate got %p, %v, want %p", again, err, model)
+	}
+
+	v, err := model.Decode([]byte(`{"Items":[{"Name":"ann"}],"Total":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var total int
+	if err = model.Field(v, ".Total").Value(&total); err != nil || total != 1 {
+		t.Errorf("total got %d, %v", total, err)
+	}
+
+	if data, _ := model.Encode(v); string(data) != `{"Items":[{"Name":"ann"}],"Total":1}` {
+		t.Errorf("encode got %s", data)
+	}
+
+	_, err = models.Instantiate("page", "user", "user")
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) || schemaErr.Kind != SchemaErrInstantiate {
+		t.Errorf("arity error got %v", err)
+	}
+
+	if _, err = models.Instantiate("user", "user"); !errors.As(err, &schemaErr) || schemaErr.Kind != SchemaErrInstantiate {
+		t.Errorf("non generic error got %v", err)
+	}
+
+	if _, err = models.Instantiate("missing", "user"); err == nil {
+		t.Error("missing template should fail")
+	}
+
+	if _, exist := models.GetModel("page<user,user>"); exist {
+		t.Error("failed instantiation should not be registered")
+	}
+}
@@ -0,0 +1,360 @@
+package dmod
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+var (
+	typeOfString = reflect.TypeOf("")
+)
+
+// Encode marshals the instance v to json, scalars are written by their
+// Format functions
+func (p *Model) Encode(v interface{}) ([]byte, error) {
+	return p.encodeJSON(reflect.ValueOf(v))
+}
+
+func (p *Model) encodeJSON(value reflect.Value) (data []byte, err error) {
+
+	shadow, err := toShadow(value, p.shadowType(value.Type()), p.fields, nil)
+	if err != nil {
+		return
+	}
+
+	return json.Marshal(shadow.Interface())
+}
+
+// decodeJSON decodes data into the instance pointer value, the instance
+// is copied into its shadow first so bound refs are kept, unions are bound
+// and decoded after it
+func (p *Model) decodeJSON(data []byte, value reflect.Value) (err error) {
+
+	shadowTyp := p.shadowType(value.Type())
+
+	if shadowTyp == value.Type() {
+		err = json.Unmarshal(data, value.Interface())
+	} else {
+		err = p.decodeShadow(data, value, shadowTyp)
+	}
+
+	if err != nil || !p.unions {
+		return
+	}
+
+	return eachStruct(value, func(st reflect.Value) error {
+		return p.bindUnions(p.fields, st)
+	})
+}
+
+func (p *Model) decodeShadow(data []byte, value reflect.Value, shadowTyp reflect.Type) (err error) {
+
+	shadow, err := toShadow(value, shadowTyp, p.fields, nil)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(data, shadow.Interface())
+	if err != nil {
+		return
+	}
+
+	decoded, err := fromShadow(shadow, value.Type(), p.fields, nil)
+	if err != nil {
+		return
+	}
+
+	value.Elem().Set(decoded.Elem())
+
+	return
+}
+
+// shadowType returns typ with the scalar fields of the model replaced by
+// strings and sql.Null types by pointers, typ is composed of pointers, slices, arrays and maps over the
+// model, it is typ itself when the model has no scalars
+func (p *Model) shadowType(typ reflect.Type) reflect.Type {
+	if shadow, exist := p.shadows.Load(typ); exist {
+		return shadow.(reflect.Type)
+	}
+
+	shadow := shadowOf(typ, p.fields, nil)
+
+	p.shadows.Store(typ, shadow)
+
+	return shadow
+}
+
+func shadowOf(typ reflect.Type, fields []Field, scalar *Scalar) reflect.Type {
+
+	if scalar != nil && typ == scalar.typ {
+		return typeOfString
+	}
+
+	if sqlNullValueTypes[typ] {
+		return reflect.PtrTo(typ.Field(0).Type)
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		if elem := shadowOf(typ.Elem(), fields, scalar); elem != typ.Elem() {
+			return reflect.PtrTo(elem)
+		}
+	case reflect.Slice:
+		if elem := shadowOf(typ.Elem(), fields, scalar); elem != typ.Elem() {
+			return reflect.SliceOf(elem)
+		}
+	case reflect.Array:
+		if elem := shadowOf(typ.Elem(), fields, scalar); elem != typ.Elem() {
+			return reflect.ArrayOf(typ.Len(), elem)
+		}
+	case reflect.Map:
+		if elem := shadowOf(typ.Elem(), fields, scalar); elem != typ.Elem() {
+			return reflect.MapOf(typ.Key(), elem)
+		}
+	case reflect.Struct:
+		if scalar != nil || len(fields) == 0 || typ == typeOfRef {
+			return typ
+		}
+
+		changed := false
+
+		sFields := make([]reflect.StructField, typ.NumField())
+
+		for i := 0; i < typ.NumField(); i++ {
+			sFields[i] = typ.Field(i)
+
+			field := shadowField(fields, sFields[i])
+			if field == nil {
+				continue
+			}
+
+			if shadow := shadowOf(sFields[i].Type, field.Children, field.scalar); shadow != sFields[i].Type {
+				sFields[i].Type = shadow
+				changed = true
+			}
+		}
+
+		if changed {
+			return reflect.StructOf(sFields)
+		}
+	}
+
+	return typ
+}
+
+// shadowField returns the definition of the struct field, fields of
+// recursive refs are skipped because Ref marshals itself
+func shadowField(fields []Field, sField reflect.StructField) *Field {
+	if sField.Anonymous && sField.Type.Name() != "" {
+		return nil
+	}
+
+	for i := 0; i < len(fields); i++ {
+		if fields[i].Name == sField.Name {
+			if len(fields[i].lateRef) > 0 {
+				return nil
+			}
+			return &fields[i]
+		}
+	}
+
+	return nil
+}
+
+// toShadow copies value into a value of the shadow type, scalars are
+// formatted, zero scalars are written as empty strings
+func toShadow(value reflect.Value, shadowTyp reflect.Type, fields []Field, scalar *Scalar) (shadow reflect.Value, err error) {
+
+	if value.Type() == shadowTyp {
+		return value, nil
+	}
+
+	shadow = reflect.New(shadowTyp).Elem()
+
+	if sqlNullValueTypes[value.Type()] {
+		if unwrapped, null := nullValue(value); !null {
+			shadow.Set(reflect.New(shadowTyp.Elem()))
+			shadow.Elem().Set(unwrapped)
+		}
+		return
+	}
+
+	if scalar != nil && value.Type() == scalar.typ {
+		if value.IsZero() {
+			return
+		}
+
+		var s string
+		s, err = scalar.format(value)
+		if err != nil {
+			err = fmt.Errorf("format scalar %s failed, %w", scalar.Name, err)
+			return
+		}
+
+		shadow.SetString(s)
+		return
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() {
+			return
+		}
+
+		var elem reflect.Value
+		elem, err = toShadow(value.Elem(), shadowTyp.Elem(), fields, scalar)
+		if err != nil {
+			return
+		}
+
+		shadow.Set(reflect.New(shadowTyp.Elem()))
+		shadow.Elem().Set(elem)
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice {
+			if value.IsNil() {
+				return
+			}
+			shadow.Set(reflect.MakeSlice(shadowTyp, value.Len(), value.Len()))
+		}
+
+		for i := 0; i < value.Len(); i++ {
+			var item reflect.Value
+			item, err = toShadow(value.Index(i), shadowTyp.Elem(), fields, scalar)
+			if err != nil {
+				return
+			}
+			shadow.Index(i).Set(item)
+		}
+	case reflect.Map:
+		if value.IsNil() {
+			return
+		}
+
+		shadow.Set(reflect.MakeMapWithSize(shadowTyp, value.Len()))
+
+		iter := value.MapRange()
+		for iter.Next() {
+			var item reflect.Value
+			item, err = toShadow(iter.Value(), shadowTyp.Elem(), fields, scalar)
+			if err != nil {
+				return
+			}
+			shadow.SetMapIndex(iter.Key(), item)
+		}
+	case reflect.Struct:
+		for i := 0; i < shadowTyp.NumField(); i++ {
+			sField := shadowTyp.Field(i)
+
+			var field Field
+			if f := shadowField(fields, sField); f != nil {
+				field = *f
+			}
+
+			var item reflect.Value
+			item, err = toShadow(value.Field(i), sField.Type, field.Children, field.scalar)
+			if err != nil {
+				err = fmt.Errorf("field %s, %w", sField.Name, err)
+				return
+			}
+			shadow.Field(i).Set(item)
+		}
+	}
+
+	return
+}
+
+// fromShadow copies the shadow back into a value of typ, scalars are
+// parsed and validated, empty strings are zero scalars
+func fromShadow(shadow reflect.Value, typ reflect.Type, fields []Field, scalar *Scalar) (value reflect.Value, err error) {
+
+	if shadow.Type() == typ {
+		return shadow, nil
+	}
+
+	value = reflect.New(typ).Elem()
+
+	if sqlNullValueTypes[typ] {
+		if !shadow.IsNil() {
+			value.Field(0).Set(shadow.Elem())
+			value.FieldByName("Valid").SetBool(true)
+		}
+		return
+	}
+
+	if scalar != nil && typ == scalar.typ {
+		if len(shadow.String()) == 0 {
+			return
+		}
+
+		value, err = scalar.parse(shadow.String())
+		return
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		if shadow.IsNil() {
+			return
+		}
+
+		var elem reflect.Value
+		elem, err = fromShadow(shadow.Elem(), typ.Elem(), fields, scalar)
+		if err != nil {
+			return
+		}
+
+		value.Set(reflect.New(typ.Elem()))
+		value.Elem().Set(elem)
+	case reflect.Slice, reflect.Array:
+		if typ.Kind() == reflect.Slice {
+			if shadow.IsNil() {
+				return
+			}
+			value.Set(reflect.MakeSlice(typ, shadow.Len(), shadow.Len()))
+		}
+
+		for i := 0; i < shadow.Len(); i++ {
+			var item reflect.Value
+			item, err = fromShadow(shadow.Index(i), typ.Elem(), fields, scalar)
+			if err != nil {
+				return
+			}
+			value.Index(i).Set(item)
+		}
+	case reflect.Map:
+		if shadow.IsNil() {
+			return
+		}
+
+		value.Set(reflect.MakeMapWithSize(typ, shadow.Len()))
+
+		iter := shadow.MapRange()
+		for iter.Next() {
+			var item reflect.Value
+			item, err = fromShadow(iter.Value(), typ.Elem(), fields, scalar)
+			if err != nil {
+				return
+			}
+			value.SetMapIndex(iter.Key(), item)
+		}
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			sField := typ.Field(i)
+
+			var field Field
+			if f := shadowField(fields, sField); f != nil {
+				field = *f
+			}
+
+			var item reflect.Value
+			item, err = fromShadow(shadow.Field(i), sField.Type, field.Children, field.scalar)
+			if err != nil {
+				err = fmt.Errorf("field %s, %w", sField.Name, err)
+				return
+			}
+			value.Field(i).Set(item)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,376 @@
+package dmod
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	errorLineRegexp  = regexp.MustCompile(`line (\d+)`)
+	tomlBundleRegexp = regexp.MustCompile(`^\s*\[\[\s*models\s*\]\]`)
+)
+
+// osFS opens names as paths of the operating system, so files given by
+// path share the fs.FS code path with LoadFromFS
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+// walkModelFiles calls fn for every model file under root of fsys,
+// hidden directories are skipped
+func walkModelFiles(fsys fs.FS, root string, fn func(name string, d fs.DirEntry) error) error {
+
+	walkFn := func(name string, d fs.DirEntry, e error) error {
+
+		if e != nil {
+			return e
+		}
+
+		if d.IsDir() {
+			if isHiddenDir(name) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if !isModelFile(name) {
+			return nil
+		}
+
+		return fn(name, d)
+	}
+
+	return fs.WalkDir(fsys, root, walkFn)
+}
+
+// readModelFile decodes the model file name of fsys into allModels and
+// allEnums, file is the path recorded for error messages, models without
+// a package key are put into pkg, decode errors are collected into errs so
+// that every broken file is reported, loaded holds the models of the load
+func readModelFile(fsys fs.FS, name, file, pkg string, allModels map[string]*ModelConfig, loaded map[string]string, allEnums map[string]*EnumConfig, errs *SchemaErrors) (err error) {
+
+	logrus.WithField("file", file).Debug("begin load")
+
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return
+	}
+
+	modelConfigs, enumConfigs, decodeErr := decodeModelConfigs(file, pkg, data)
+	if decodeErr != nil {
+		errs.add(decodeErr)
+		return
+	}
+
+	addEnumConfigs(allEnums, enumConfigs)
+	addModelConfigs(allModels, loaded, modelConfigs, file, errs)
+
+	return
+}
+
+// addModelConfigs adds modelConfigs into allModels, a model replaces the one
+// of a former load with the same name, a name defined twice in one load is
+// an error, loaded records the source of every model of the load, source
+// names the configs without a file, e.g. `schema 1`
+func addModelConfigs(allModels map[string]*ModelConfig, loaded map[string]string, modelConfigs []ModelConfig, source string, errs *SchemaErrors) {
+	for i := 0; i < len(modelConfigs); i++ {
+		modelConfig := modelConfigs[i]
+
+		at := source
+		if len(modelConfig.filepath) > 0 {
+			at = modelConfig.Source()
+		} else if modelConfig.line > 0 {
+			at = source + ":" + strconv.Itoa(modelConfig.line)
+		}
+
+		if former, exist := loaded[modelConfig.Name]; exist {
+			errs.add(&SchemaError{
+				Kind:   SchemaErrDuplicate,
+				Model:  modelConfig.Name,
+				File:   modelConfig.filepath,
+				Line:   modelConfig.line,
+				Target: former,
+				Err:    fmt.Errorf("model %s is defined at %s and %s", modelConfig.Name, former, at),
+			})
+			continue
+		}
+
+		if _, existModel := allModels[modelConfig.Name]; existModel {
+			logrus.WithField("model", modelConfig.Name).WithField("file", at).Warnln("model already exist")
+		}
+
+		allModels[modelConfig.Name] = &modelConfig
+		loaded[modelConfig.Name] = at
+		logrus.WithField("file", at).WithField("model", modelConfig.Name).Debug("model loaded")
+	}
+}
+
+// modelDocument is the content of a model file, either a single model
+// or a bundle of models in ModelsConfig form, both could declare enums
+type modelDocument struct {
+	ModelConfig  `yaml:",inline"`
+	ModelsConfig `yaml:",inline"`
+}
+
+// addEnumConfigs adds enumConfigs into allEnums, a later enum replaces
+// the former one with the same name
+func addEnumConfigs(allEnums map[string]*EnumConfig, enumConfigs []EnumConfig) {
+	for i := 0; i < len(enumConfigs); i++ {
+		enumConfig := enumConfigs[i]
+
+		if _, exist := allEnums[enumConfig.name]; exist {
+			logrus.WithField("enum", enumConfig.name).WithField("file", enumConfig.filepath).Warnln("enum already exist")
+		}
+
+		allEnums[enumConfig.name] = &enumConfig
+	}
+}
+
+// decodeModelConfigs decodes data by the extension of file, json is used
+// when file has no known extension, models of a bundle keep their line and
+// share the package and imports of the bundle, models without package are
+// put into pkg, enums are sorted by name
+func decodeModelConfigs(file, pkg string, data []byte) (modelConfigs []ModelConfig, enumConfigs []EnumConfig, schemaErr *SchemaError) {
+
+	var doc modelDocument
+	var decodeErr error
+
+	format := modelFileFormat(file)
+
+	switch format {
+	case ".yaml", ".yml":
+		decodeErr = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		_, decodeErr = toml.Decode(string(data), &doc)
+	default:
+		decodeErr = json.Unmarshal(data, &doc)
+	}
+
+	if decodeErr == nil && len(doc.Models) > 0 && len(doc.Name) > 0 {
+		decodeErr = fmt.Errorf("name %s and models could not be declared together", doc.Name)
+	}
+
+	if decodeErr != nil {
+		schemaErr = &SchemaError{
+			Kind: SchemaErrDecode,
+			File: file,
+			Line: errorLine(data, decodeErr),
+			Err:  decodeErr,
+		}
+		return
+	}
+
+	var enumNames []string
+	for name := range doc.Enums {
+		enumNames = append(enumNames, name)
+	}
+
+	sort.Strings(enumNames)
+
+	for _, name := range enumNames {
+		enumConfig := doc.Enums[name]
+		enumConfig.name = name
+		enumConfig.filepath = file
+		enumConfigs = append(enumConfigs, enumConfig)
+	}
+
+	if len(doc.Models) == 0 {
+		if len(doc.Name) > 0 || len(enumConfigs) == 0 {
+			modelConfigs = []ModelConfig{doc.ModelConfig}
+		}
+	} else {
+		modelConfigs = doc.Models
+
+		lines := bundleModelLines(format, data)
+		if len(lines) == len(modelConfigs) {
+			for i := 0; i < len(modelConfigs); i++ {
+				modelConfigs[i].line = lines[i]
+			}
+		}
+
+		for i := 0; i < len(modelConfigs); i++ {
+			modelConfigs[i].qualify(doc.Package)
+			modelConfigs[i].Imports = append(append([]string{}, doc.Imports...), modelConfigs[i].Imports...)
+		}
+	}
+
+	for i := 0; i < len(modelConfigs); i++ {
+		modelConfigs[i].qualify(pkg)
+		modelConfigs[i].mergeExtends()
+		modelConfigs[i].filepath = file
+		modelConfigs[i].originalFields = modelConfigs[i].Fields
+	}
+
+	return
+}
+
+// bundleModelLines returns the line of every model of a bundle in order,
+// nil if the lines could not be found
+func bundleModelLines(format string, data []byte) []int {
+	switch format {
+	case ".yaml", ".yml":
+		return yamlBundleLines(data)
+	case ".toml":
+		return tomlBundleLines(data)
+	}
+	return jsonBundleLines(data)
+}
+
+func jsonBundleLines(data []byte) []int {
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+
+	if tok, err := decoder.Token(); err != nil || tok != json.Delim('{') {
+		return nil
+	}
+
+	for decoder.More() {
+		tok, err := decoder.Token()
+		if err != nil {
+			return nil
+		}
+
+		if tok != "models" {
+			var skip json.RawMessage
+			if decoder.Decode(&skip) != nil {
+				return nil
+			}
+			continue
+		}
+
+		if tok, err = decoder.Token(); err != nil || tok != json.Delim('[') {
+			return nil
+		}
+
+		var lines []int
+
+		for decoder.More() {
+			offset := decoder.InputOffset()
+			for offset < int64(len(data)) && strings.ContainsRune(" \t\r\n,", rune(data[offset])) {
+				offset++
+			}
+
+			lines = append(lines, lineOfOffset(data, offset))
+
+			var skip json.RawMessage
+			if decoder.Decode(&skip) != nil {
+				return nil
+			}
+		}
+
+		return lines
+	}
+
+	return nil
+}
+
+func yamlBundleLines(data []byte) []int {
+
+	var root yaml.Node
+
+	if yaml.Unmarshal(data, &root) != nil || len(root.Content) == 0 {
+		return nil
+	}
+
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value != "models" {
+			continue
+		}
+
+		var lines []int
+		for _, item := range doc.Content[i+1].Content {
+			lines = append(lines, item.Line)
+		}
+
+		return lines
+	}
+
+	return nil
+}
+
+func tomlBundleLines(data []byte) []int {
+	var lines []int
+
+	for i, line := range strings.Split(string(data), "\n") {
+		if tomlBundleRegexp.MatchString(line) {
+			lines = append(lines, i+1)
+		}
+	}
+
+	return lines
+}
+
+func modelFileFormat(file string) string {
+	return strings.ToLower(path.Ext(filepath.ToSlash(file)))
+}
+
+func lineOfOffset(data []byte, offset int64) int {
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// errorLine returns the line in data where decoding failed, 0 if unknown
+func errorLine(data []byte, err error) int {
+
+	offset := int64(-1)
+
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	case toml.ParseError:
+		return e.Position.Line
+	}
+
+	if offset >= 0 && offset <= int64(len(data)) {
+		return lineOfOffset(data, offset)
+	}
+
+	matches := errorLineRegexp.FindStringSubmatch(err.Error())
+	if len(matches) == 2 {
+		line, _ := strconv.Atoi(matches[1])
+		return line
+	}
+
+	return 0
+}
+
+func joinModelPath(dir, name string) string {
+	if len(dir) == 0 {
+		return name
+	}
+	return filepath.Join(dir, filepath.FromSlash(name))
+}
+
+func isModelFile(name string) bool {
+	switch modelFileFormat(name) {
+	case ".json", ".yaml", ".yml", ".toml":
+		return true
+	}
+	return false
+}
+
+func isHiddenDir(name string) bool {
+	base := path.Base(name)
+	return base != "." && base != ".." && strings.HasPrefix(base, ".")
+}
@@ -0,0 +1,152 @@
+package dmod
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDecodeErrorLine(t *testing.T) {
+	cases := []struct {
+		file string
+		data string
+		line int
+	}{
+		{"user.json", "{\n  \"name\": \"user\",\n  \"fields\": [\n    {\"name\": \"ID\",}\n  ]\n}", 4},
+		{"user.json", "{\n  \"name\": \"user\",\n  \"fields\": 3\n}", 3},
+		{"user.yaml", "name: user\nfields:\n  - name: ID\n     type: int\n", 4},
+		{"user.yaml", "name: user\n\tfields: []\n", 2},
+		{"user.toml", "name = \"user\"\n\n[[fields]]\nname = wat\n", 4},
+	}
+
+	for _, c := range cases {
+		_, _, err := decodeModelConfigs(c.file, "", []byte(c.data))
+		if err == nil {
+			t.Errorf("%s, expect error", c.file)
+			continue
+		}
+		if err.Kind != SchemaErrDecode || err.File != c.file {
+			t.Errorf("%s, unexpected error %s", c.file, err)
+		}
+		if err.Line != c.line {
+			t.Errorf("%s, error at line %d, want %d, %s", c.file, err.Line, c.line, err)
+		}
+	}
+}
+
+func TestBundleModelLines(t *testing.T) {
+	cases := []struct {
+		file  string
+		data  string
+		lines []int
+	}{
+		{"b.json", "{\n  \"models\": [\n    {\"name\": \"a\"},\n\n    {\"name\": \"b\"}\n  ]\n}", []int{3, 5}},
+		{"b.yaml", "models:\n  - name: a\n  - name: b\n    fields: []\n  - name: c\n", []int{2, 3, 5}},
+		{"b.toml", "[[models]]\nname = \"a\"\n\n[[models]]\nname = \"b\"\n", []int{1, 4}},
+	}
+
+	for _, c := range cases {
+		configs, _, err := decodeModelConfigs(c.file, "", []byte(c.data))
+		if err != nil {
+			t.Fatalf("%s, %s", c.file, err)
+		}
+
+		if len(configs) != len(c.lines) {
+			t.Fatalf("%s, got %d models, want %d", c.file, len(configs), len(c.lines))
+		}
+
+		for i, config := range configs {
+			if config.line != c.lines[i] {
+				t.Errorf("%s, model %s at line %d, want %d", c.file, config.Name, config.line, c.lines[i])
+			}
+		}
+	}
+}
+
+func TestDuplicateModels(t *testing.T) {
+	address := `{"package":"billing","name":"address","fields":[{"name":"City","type":"string"}]}`
+
+	models, _ := NewModels()
+
+	err := models.LoadModels([]string{address, address})
+
+	var errs SchemaErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Kind != SchemaErrDuplicate {
+		t.Fatalf("expect a duplicate error, got %v", err)
+	}
+
+	if !strings.Contains(errs[0].Error(), "schema 0 and schema 1") {
+		t.Errorf("expect both sources, got %v", errs[0])
+	}
+
+	fsys := fstest.MapFS{
+		"a.json": {Data: []byte(address)},
+		"b.yaml": {Data: []byte("package: billing\nmodels:\n  - name: address\n    fields:\n      - name: City\n        type: string\n")},
+	}
+
+	err = models.LoadFromFS(fsys, ".")
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Kind != SchemaErrDuplicate {
+		t.Fatalf("expect a duplicate error, got %v", err)
+	}
+
+	if errs[0].File != "b.yaml" || errs[0].Line != 3 || errs[0].Target != "a.json" {
+		t.Errorf("expect both sources, got %v", errs[0])
+	}
+
+	if err = models.LoadModels([]string{address}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = models.LoadModels([]string{address}); err != nil {
+		t.Errorf("a later load should replace the model, got %v", err)
+	}
+}
+
+func TestLoadFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"models/user.json":         {Data: []byte(`{"name":"user","fields":[{"name":"Address","ref":"address"}]}`)},
+		"models/nested/addr.yaml":  {Data: []byte("name: address\nfields:\n  - name: City\n    type: string\n")},
+		"models/nested/lang.toml":  {Data: []byte("name = \"language\"\n[[fields]]\nname = \"Code\"\ntype = \"string\"\n")},
+		"models/README.md":         {Data: []byte("not a model")},
+		"models/.git/broken.json":  {Data: []byte(`{broken`)},
+		"models/nested/.tmp/x.yml": {Data: []byte(`name: [`)},
+		"other/skipped.json":       {Data: []byte(`{"name":"skipped","fields":[]}`)},
+	}
+
+	models, _ := NewModels()
+
+	if err := models.LoadFromFS(fsys, "models"); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, model := range models.Models() {
+		names = append(names, model.Name())
+	}
+
+	if strings.Join(names, ",") != "address,language,user" {
+		t.Errorf("loaded models got %v", names)
+	}
+
+	user, _ := models.GetModel("user")
+
+	v, err := user.Decode([]byte(`{"Address":{"City":"Paris"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var city string
+	if err = user.Field(v, ".Address.City").Value(&city); err != nil || city != "Paris" {
+		t.Errorf("city got %q, %v", city, err)
+	}
+
+	fsys["models/nested/bad.json"] = &fstest.MapFile{Data: []byte(`{broken`)}
+
+	err = models.LoadFromFS(fsys, "models")
+
+	var errs SchemaErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].File != "models/nested/bad.json" {
+		t.Errorf("expect an error of the visible file only, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package dmod
 
 import (
 	"encoding/json"
+	"fmt"
 	"reflect"
 	"strings"
 	"sync"
@@ -22,44 +23,108 @@ type Model struct {
 
 	config ModelConfig
 
-	locker sync.Mutex
+	// refs are the recursive ref fields, they are bound to the models of
+	// registry, the generation the model was published in
+	refs     []refBinding
+	registry map[string]*Model
+
+	// unions reports whether the model holds oneOf fields, they are bound
+	// to the models of registry too
+	unions bool
+
+	// shadows caches the json shadow types, see shadowType
+	shadows *sync.Map
+
+	// owner publishes the edits of the model
+	owner *Models
 }
 
 func (p *Model) Name() string {
 	return p.name
 }
 
+// Abstract reports whether the model is only used by extends and refs
+func (p *Model) Abstract() bool {
+	return p.config.Abstract
+}
+
+// Internal reports whether the model is hidden from listings and dumps
+func (p *Model) Internal() bool {
+	return p.config.Internal
+}
+
+// Package returns the package the model is declared in, empty for models
+// out of packages
+func (p *Model) Package() string {
+	return p.config.Package
+}
+
 func (p *Model) Fields() []Field {
 	return p.fields
 }
 
 func (p *Model) Dump() string {
-	conf := p.config
-	conf.reset()
-
-	dumpData, _ := json.MarshalIndent(conf, "", "    ")
+	dumpData, _ := json.MarshalIndent(p.dumped(), "", "    ")
 	return string(dumpData)
 }
 
-func (p *Model) Combine(combineMap map[string]interface{}) (err error) {
-	p.locker.Lock()
-	defer p.locker.Unlock()
+func (p *Model) dumped() dumpedModel {
+	conf := dumpedModel{
+		ModelConfig: p.config.clone(),
+		Source:      p.config.Source(),
+	}
 
-	p.combineMap = combineMap
+	for _, enum := range p.Enums() {
+		if conf.Enums == nil {
+			conf.Enums = map[string]EnumConfig{}
+		}
+		conf.Enums[enum.name] = enum.config
+	}
 
-	return
+	return conf
 }
 
-func (p *Model) Delete(name string) (deleted bool, err error) {
-	var fields []Field
+// Enums returns the enums used by the fields of the model
+func (p *Model) Enums() []*Enum {
+	return sortedEnums(usedEnums(p.fields, nil))
+}
 
-	fields, deleted = deleteField(name, p.fields)
+// Source returns where the model was declared, empty for models which
+// are not loaded from files
+func (p *Model) Source() string {
+	return p.config.Source()
+}
+
+// dumpedModel is the dump form of a model, it could be loaded again
+type dumpedModel struct {
+	ModelConfig
+	Source string                `json:"source,omitempty"`
+	Enums  map[string]EnumConfig `json:"enums,omitempty"`
+}
 
-	if !deleted {
+// Combine publishes a copy of the model with combineMap, model is the
+// published one, p is left unchanged
+func (p *Model) Combine(combineMap map[string]interface{}) (model *Model, err error) {
+	return p.edit(func(latest *Model) (next *Model, err error) {
+		next = latest.clone()
+		next.combineMap = combineMap
 		return
-	}
+	})
+}
+
+// Delete publishes a copy of the model without the field name, model is
+// the latest generation of the model, p is left unchanged
+func (p *Model) Delete(name string) (model *Model, deleted bool, err error) {
+	model, err = p.edit(func(latest *Model) (next *Model, err error) {
+		var fields []Field
+
+		fields, deleted = deleteField(name, copyFields(latest.fields))
+		if !deleted {
+			return
+		}
 
-	err = p.updateStruct(fields)
+		return latest.rebuild(fields)
+	})
 
 	if err != nil {
 		deleted = false
@@ -68,24 +133,30 @@ func (p *Model) Delete(name string) (deleted bool, err error) {
 	return
 }
 
-func (p *Model) Insert(onFiled string, fields []Field) (effect int, err error) {
+// Insert publishes a copy of the model with fields inserted after the field
+// onFiled, model is the latest generation of the model, p is left unchanged
+func (p *Model) Insert(onFiled string, fields []Field) (model *Model, effect int, err error) {
 
 	succesCount := 0
-	var newFields = p.fields
 
-	for i := 0; i < len(fields); i++ {
-		var inserted bool
-		newFields, inserted = insertField(onFiled, fields[i], newFields)
-		if inserted {
-			succesCount++
+	model, err = p.edit(func(latest *Model) (next *Model, err error) {
+		var newFields = copyFields(latest.fields)
+
+		for i := 0; i < len(fields); i++ {
+			var inserted bool
+			newFields, inserted = insertField(onFiled, fields[i], newFields)
+			if inserted {
+				succesCount++
+			}
 		}
-	}
 
-	if succesCount == 0 {
-		return
-	}
+		if succesCount == 0 {
+			return
+		}
+
+		return latest.rebuild(newFields)
+	})
 
-	err = p.updateStruct(newFields)
 	if err == nil {
 		effect = succesCount
 	}
@@ -93,15 +164,52 @@ func (p *Model) Insert(onFiled string, fields []Field) (effect int, err error) {
 	return
 }
 
-func (p *Model) Update(onFiled string, field Field) (updated bool, err error) {
+// Update publishes a copy of the model with the field onFiled replaced,
+// model is the latest generation of the model, p is left unchanged
+func (p *Model) Update(onFiled string, field Field) (model *Model, updated bool, err error) {
+	model, err = p.edit(func(latest *Model) (next *Model, err error) {
+		var fields []Field
 
-	var fields []Field
-	fields, updated = updateField(onFiled, field, p.fields)
-	if !updated {
-		return
+		fields, updated = updateField(onFiled, field, copyFields(latest.fields))
+		if !updated {
+			return
+		}
+
+		return latest.rebuild(fields)
+	})
+
+	if err != nil {
+		updated = false
 	}
 
-	err = p.updateStruct(fields)
+	return
+}
+
+// GetField returns the definition of the field at path, e.g. `.Address.City`
+func (p *Model) GetField(name string) (Field, bool) {
+	return findField(name, p.fields)
+}
+
+// MergeTags publishes a copy of the model with the tag keys of the field at
+// path set, model is the latest generation of the model, p is left unchanged
+func (p *Model) MergeTags(onFiled string, tags map[string]string) (model *Model, updated bool, err error) {
+	model, err = p.edit(func(latest *Model) (next *Model, err error) {
+		field, exist := latest.GetField(onFiled)
+		if !exist {
+			return
+		}
+
+		field.MergeTags(tags)
+
+		var fields []Field
+
+		fields, updated = updateField(onFiled, field, copyFields(latest.fields))
+		if !updated {
+			return
+		}
+
+		return latest.rebuild(fields)
+	})
 
 	if err != nil {
 		updated = false
@@ -110,20 +218,80 @@ func (p *Model) Update(onFiled string, field Field) (updated bool, err error) {
 	return
 }
 
-func (p *Model) updateStruct(fields []Field) (err error) {
-	p.locker.Lock()
-	defer p.locker.Unlock()
+// edit publishes the model fn returns for the latest generation of p, model
+// is the published one, or the latest generation when fn changes nothing
+func (p *Model) edit(fn func(latest *Model) (next *Model, err error)) (model *Model, err error) {
+	if p.owner == nil {
+		return nil, fmt.Errorf("model %s is not registered", p.name)
+	}
+
+	p.owner.locker.Lock()
+	defer p.owner.locker.Unlock()
+
+	latest, exist := p.owner.Snapshot().GetModel(p.name)
+	if !exist {
+		latest = p
+	}
+
+	next, err := fn(latest)
+	if err != nil {
+		return
+	}
+
+	if next == nil {
+		return latest, nil
+	}
+
+	p.owner.replaceModel(next)
+
+	return next, nil
+}
+
+func (p *Model) clone() *Model {
+	return &Model{
+		name:         p.name,
+		fields:       p.fields,
+		structOf:     p.structOf,
+		structFields: p.structFields,
+		combineMap:   p.combineMap,
+		builder:      p.builder,
+		config:       p.config,
+		refs:         p.refs,
+		unions:       p.unions,
+		shadows:      p.shadows,
+		owner:        p.owner,
+	}
+}
+
+// rebuild returns a copy of the model built from fields
+func (p *Model) rebuild(fields []Field) (model *Model, err error) {
+
+	fields = builderFields(p.builder, fields)
+
+	annotateScalars(fields, p.builder)
 
 	sfileds, err := p.builder.Build(fields, p.combineMap)
+	if err != nil {
+		return
+	}
 
+	structOf, err := structOf(sfileds)
 	if err != nil {
 		return
 	}
 
-	p.structFields = sfileds
-	p.fields = fields
+	refs, err := collectRefBindings(fields, structOf, nil)
+	if err != nil {
+		return
+	}
 
-	p.structOf = reflect.StructOf(sfileds)
+	model = p.clone()
+	model.structFields = sfileds
+	model.fields = fields
+	model.refs = refs
+	model.unions = hasUnions(fields)
+	model.shadows = &sync.Map{}
+	model.structOf = structOf
 
 	return
 }
@@ -143,9 +311,137 @@ func (p *Model) New(values ...interface{}) interface{} {
 
 	p.updateSlice(st)
 
+	p.bindRefs(st)
+
+	if p.unions {
+		p.bindUnions(p.fields, st)
+	}
+
 	return st.Interface()
 }
 
+// Decode creates an instance and decodes the json data into it, scalars
+// are parsed, values out of the enums of fields are rejected
+func (p *Model) Decode(data []byte) (v interface{}, err error) {
+	instance := p.New()
+
+	err = p.decodeJSON(data, reflect.ValueOf(instance))
+	if err != nil {
+		return
+	}
+
+	err = p.Validate(instance)
+	if err != nil {
+		return
+	}
+
+	v = instance
+
+	return
+}
+
+// Validate checks the values of the enum and scalar fields of the
+// instance v, instances held by recursive refs are checked when they are
+// decoded, the variants of unions are checked by their models
+func (p *Model) Validate(v interface{}) error {
+	return validateFields(p.fields, reflect.ValueOf(v), "")
+}
+
+func validateFields(fields []Field, v reflect.Value, path string) (err error) {
+
+	v = indirect(v)
+
+	if !v.IsValid() || v.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < len(fields); i++ {
+		field := &fields[i]
+
+		fieldValue := v.FieldByName(field.Name)
+		if !fieldValue.IsValid() {
+			continue
+		}
+
+		fieldPath := path + "." + field.Name
+
+		if err = field.checkDecimals(fieldValue); err != nil {
+			return fmt.Errorf("invalid value of field %s, %w", fieldPath, err)
+		}
+
+		if len(field.OneOf) > 0 {
+			err = eachOneOf(fieldValue, func(union *OneOf) error {
+				if union.model == nil {
+					return nil
+				}
+				return union.model.Validate(union.Interface())
+			})
+
+			if err != nil {
+				return fmt.Errorf("invalid value of field %s, %w", fieldPath, err)
+			}
+			continue
+		}
+
+		if field.enum != nil {
+			if err = field.enum.Validate(fieldValue); err != nil {
+				return fmt.Errorf("invalid value of field %s, %w", fieldPath, err)
+			}
+			continue
+		}
+
+		if field.scalar != nil {
+			if err = field.scalar.validateValue(fieldValue); err != nil {
+				return fmt.Errorf("invalid value of field %s, %w", fieldPath, err)
+			}
+			continue
+		}
+
+		if len(field.lateRef) > 0 || len(field.Children) == 0 {
+			continue
+		}
+
+		err = eachStruct(fieldValue, func(st reflect.Value) error {
+			return validateFields(field.Children, st, fieldPath)
+		})
+
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// eachStruct calls fn with every struct held by v
+func eachStruct(v reflect.Value, fn func(st reflect.Value) error) (err error) {
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		return eachStruct(v.Elem(), fn)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err = eachStruct(v.Index(i), fn); err != nil {
+				return
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if err = eachStruct(iter.Value(), fn); err != nil {
+				return
+			}
+		}
+	case reflect.Struct:
+		err = fn(v)
+	}
+
+	return
+}
+
 func (p *Model) updateCombine(name string, st reflect.Value, newVal reflect.Value) {
 	name = strings.TrimSpace(name)
 	name = strings.TrimPrefix(name, ".")
@@ -173,6 +469,7 @@ func (p *Model) updateCombine(name string, st reflect.Value, newVal reflect.Valu
 	}
 }
 
+// updateSlice initializes nil slices and maps to empty ones
 func (p *Model) updateSlice(st reflect.Value) {
 
 	iST := indirect(st)
@@ -180,14 +477,20 @@ func (p *Model) updateSlice(st reflect.Value) {
 
 		fieldI := iST.Field(i)
 
-		if !fieldI.IsValid() {
+		if !fieldI.IsValid() || !fieldI.CanSet() {
 			continue
 		}
 
-		if fieldI.Kind() == reflect.Slice {
-			s := reflect.New(fieldI.Type())
-			fieldI.Set(s.Elem())
-		} else if fieldI.Kind() == reflect.Struct {
+		switch fieldI.Kind() {
+		case reflect.Slice:
+			if fieldI.IsNil() {
+				fieldI.Set(reflect.MakeSlice(fieldI.Type(), 0, 0))
+			}
+		case reflect.Map:
+			if fieldI.IsNil() {
+				fieldI.Set(reflect.MakeMap(fieldI.Type()))
+			}
+		case reflect.Struct:
 			p.updateSlice(fieldI)
 		}
 	}
@@ -206,21 +509,16 @@ func (p *Model) Field(v interface{}, name string) *ModelField {
 		return &ModelField{
 			name:       ".",
 			fieldValue: valV,
+			children:   p.fields,
 		}
 	}
 
-	names := strings.Split(name, ".")
-
-	m := &ModelField{
-		name:       "." + names[0],
-		fieldValue: reflect.Indirect(valV).FieldByName(names[0]),
+	root := &ModelField{
+		fieldValue: valV,
+		children:   p.fields,
 	}
 
-	newNames := strings.Join(names[1:], ".")
-
-	m = m.Field(newNames)
-
-	return m
+	return root.Field(name)
 }
 
 func (p *Model) copyModel(st reflect.Value, values ...interface{}) {
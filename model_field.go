@@ -1,8 +1,11 @@
 package dmod
 
 import (
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"reflect"
 	"strings"
@@ -18,6 +21,23 @@ var (
 type ModelField struct {
 	name       string
 	fieldValue reflect.Value
+
+	// field is the definition of the field, children are the definitions
+	// of its struct fields, both are nil for values not built by a model
+	field    *Field
+	children []Field
+
+	// mapValue and mapKey are set when the field is an entry of a map
+	mapValue reflect.Value
+	mapKey   reflect.Value
+
+	// commit writes the copies of map entries holding the field back
+	commit func()
+
+	// resolve walks to the field again allocating the nil pointers and the
+	// missing map entries on the way, it is set when the field was read
+	// through them, so reads never change the instance
+	resolve func() *ModelField
 }
 
 func (p *ModelField) Name() string {
@@ -36,9 +56,9 @@ func (p *ModelField) Field(name string) *ModelField {
 
 	names := strings.Split(name, ".")
 
-	m := &ModelField{
-		name:       p.name + "." + names[0],
-		fieldValue: indirect(p.fieldValue).FieldByName(name),
+	m := p.child(names[0], false)
+	if m == nil {
+		return nil
 	}
 
 	newNames := strings.Join(names[1:], ".")
@@ -50,12 +70,261 @@ func (p *ModelField) Field(name string) *ModelField {
 	return m.Field(newNames)
 }
 
+// child returns the field or the map entry called name, it allocates only when alloc is true
+func (p *ModelField) child(name string, alloc bool) (m *ModelField) {
+
+	v := p.fieldValue
+
+	detached := p.resolve != nil
+
+	defer func() {
+		if m != nil && detached {
+			m.resolve = func() *ModelField {
+				parent := p.resolved()
+				if parent == nil {
+					return nil
+				}
+				return parent.child(name, true)
+			}
+		}
+	}()
+
+	commit := p.commit
+	if p.mapValue.IsValid() && p.fieldValue.IsValid() && p.fieldValue.CanAddr() {
+		commit = p.writeBack
+	}
+
+	children := p.children
+
+	ref := p.ref()
+	if ref != nil {
+		if !ref.value.IsValid() {
+			return nil
+		}
+		v = ref.value
+		children = ref.model.fields
+	}
+
+	if union := p.oneOf(); union != nil {
+		if !union.value.IsValid() {
+			return nil
+		}
+		v = union.value
+		children = union.model.fields
+	}
+
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			switch {
+			case !alloc:
+				detached = true
+				v = reflect.Zero(v.Type().Elem())
+				continue
+			case !v.CanSet():
+				return nil
+			}
+			v.Set(newRefElem(ref, v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		m := &ModelField{
+			name:       p.name + "." + name,
+			fieldValue: v.FieldByName(name),
+			commit:     commit,
+		}
+
+		if field := promotedField(children, name); field != nil {
+			m.field = field
+			m.children = field.Children
+		}
+
+		return m
+	case reflect.Map:
+		key := reflect.ValueOf(name)
+		if !key.Type().ConvertibleTo(v.Type().Key()) {
+			return nil
+		}
+
+		key = key.Convert(v.Type().Key())
+
+		elemType := v.Type().Elem()
+
+		entry := v.MapIndex(key)
+
+		switch {
+		case elemType.Kind() == reflect.Struct:
+			entry = copyEntry(elemType, entry)
+		case elemType.Kind() != reflect.Ptr || entry.IsValid():
+		case !alloc:
+			detached = true
+			entry = reflect.Zero(elemType)
+		case v.CanSet():
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			v.SetMapIndex(key, newRefElem(ref, elemType.Elem()))
+			entry = v.MapIndex(key)
+		}
+
+		return &ModelField{
+			name:       p.name + "." + name,
+			fieldValue: entry,
+			field:      p.field,
+			children:   children,
+			mapValue:   v,
+			mapKey:     key,
+			commit:     commit,
+		}
+	}
+
+	return nil
+}
+
+// resolved returns the field itself, or the field walked again with the
+// allocations when it was read through a nil pointer or a missing entry
+func (p *ModelField) resolved() *ModelField {
+	if p == nil || p.resolve == nil {
+		return p
+	}
+	return p.resolve()
+}
+
+// copyEntry returns an addressable copy of the map entry
+func copyEntry(typ reflect.Type, entry reflect.Value) reflect.Value {
+	copied := reflect.New(typ).Elem()
+	if entry.IsValid() {
+		copied.Set(entry)
+	}
+	return copied
+}
+
+// writeBack sets the copy of the map entry to its map
+func (p *ModelField) writeBack() {
+	if p.mapValue.IsNil() {
+		if !p.mapValue.CanSet() {
+			return
+		}
+		p.mapValue.Set(reflect.MakeMap(p.mapValue.Type()))
+	}
+
+	p.mapValue.SetMapIndex(p.mapKey, p.fieldValue)
+
+	if p.commit != nil {
+		p.commit()
+	}
+}
+
+// Definition returns the definition of the field, nil if the value was not
+// built by a model
+func (p *ModelField) Definition() *Field {
+	return p.field
+}
+
+// ref returns the field as a Ref if it is a recursive ref
+func (p *ModelField) ref() *Ref {
+	if !p.fieldValue.IsValid() || p.fieldValue.Type() != typeOfRef || !p.fieldValue.CanAddr() {
+		return nil
+	}
+
+	return p.fieldValue.Addr().Interface().(*Ref)
+}
+
+// assignValue sets dst to src and reports false when src is not assignable to dst
+func assignValue(dst, src reflect.Value) bool {
+	typ := dst.Type()
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	var converted reflect.Value
+
+	switch {
+	case src.Type().AssignableTo(typ):
+		converted = src
+	case isNumberKind(src.Kind()) && isNumberKind(typ.Kind()):
+		converted = src.Convert(typ)
+	default:
+		return false
+	}
+
+	if dst.Kind() == reflect.Ptr {
+		ptr := reflect.New(typ)
+		ptr.Elem().Set(converted)
+		converted = ptr
+	}
+
+	dst.Set(converted)
+
+	return true
+}
+
+func isNumberKind(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Float64
+}
+
+// oneOf returns the field as a OneOf if it is a union
+func (p *ModelField) oneOf() *OneOf {
+	if !p.fieldValue.IsValid() || p.fieldValue.Type() != typeOfOneOf || !p.fieldValue.CanAddr() {
+		return nil
+	}
+
+	return p.fieldValue.Addr().Interface().(*OneOf)
+}
+
+// Variant returns the name of the model of the value of a union field,
+// empty if the field is not a union or it is unset
+func (p *ModelField) Variant() string {
+	if union := p.oneOf(); union != nil {
+		return union.Variant()
+	}
+	return ""
+}
+
 func (p *ModelField) Value(v interface{}) (err error) {
 
 	if !p.fieldValue.IsValid() {
 		return
 	}
 
+	if ref := p.ref(); ref != nil {
+		err = copier.Copy(v, ref.Interface())
+		return
+	}
+
+	if union := p.oneOf(); union != nil {
+		if instance := union.Interface(); instance != nil {
+			err = copier.Copy(v, instance)
+		}
+		return
+	}
+
+	target := reflect.ValueOf(v)
+	if target.Kind() == reflect.Ptr && !target.IsNil() && target.Elem().Type() == p.fieldValue.Type() {
+		target.Elem().Set(p.fieldValue)
+		return
+	}
+
+	value, null := nullValue(p.fieldValue)
+
+	if null {
+		if target.Kind() == reflect.Ptr && !target.IsNil() {
+			target.Elem().Set(reflect.Zero(target.Elem().Type()))
+		}
+		return
+	}
+
+	if target.Kind() == reflect.Ptr && !target.IsNil() && assignValue(target.Elem(), value) {
+		return
+	}
+
+	if sqlNullValueTypes[p.fieldValue.Type()] {
+		err = copier.Copy(v, value.Interface())
+		return
+	}
+
 	err = copier.Copy(v, p.fieldValue.Interface())
 
 	return
@@ -67,10 +336,65 @@ func (p *ModelField) Interface() interface{} {
 		return nil
 	}
 
+	if ref := p.ref(); ref != nil && ref.value.IsValid() {
+		return ref.value.Addr().Interface()
+	}
+
+	if union := p.oneOf(); union != nil && union.value.IsValid() {
+		return union.Interface()
+	}
+
+	if !p.fieldValue.CanAddr() || p.mapValue.IsValid() {
+		return p.fieldValue.Interface()
+	}
+
 	return p.fieldValue.Addr().Interface()
 }
 
+// Set sets the value of the field, strings are parsed by the scalar of
+// the field, values of enum and scalar fields are checked before they are
+// set, values which could not be converted are scanned by sql.Scanner,
+// unions take instances of their variants, nil sets null
 func (p *ModelField) Set(value interface{}) (err error) {
+	if p.resolve != nil {
+		field := p.resolved()
+		if field == nil {
+			return errors.New("field value not valid")
+		}
+		return field.Set(value)
+	}
+
+	defer func() {
+		if err == nil && p.commit != nil {
+			p.commit()
+		}
+	}()
+
+	if p.field != nil && p.field.enum != nil {
+		if err = p.field.enum.Validate(value); err != nil {
+			return fmt.Errorf("invalid value of field %s, %w", p.name, err)
+		}
+	}
+
+	if p.field != nil && p.field.scalar != nil {
+		if value, err = p.coerceScalar(value); err != nil {
+			return fmt.Errorf("invalid value of field %s, %w", p.name, err)
+		}
+	}
+
+	if p.mapValue.IsValid() {
+		if p.field != nil {
+			reflectValue, ok := value.(reflect.Value)
+			if !ok {
+				reflectValue = reflect.ValueOf(value)
+			}
+			if err = p.field.checkDecimals(reflectValue); err != nil {
+				return fmt.Errorf("invalid value of field %s, %w", p.name, err)
+			}
+		}
+		return p.setMapEntry(value)
+	}
+
 	if !p.fieldValue.IsValid() {
 		return errors.New("field value not valid")
 	}
@@ -79,6 +403,18 @@ func (p *ModelField) Set(value interface{}) (err error) {
 		return errors.New("using unaddressable value")
 	}
 
+	if p.field != nil && (p.field.Precision > 0 || p.field.Scale > 0) {
+		return p.setDecimals(value)
+	}
+
+	if ref := p.ref(); ref != nil {
+		return ref.Set(value)
+	}
+
+	if union := p.oneOf(); union != nil {
+		return union.Set(value)
+	}
+
 	reflectValue, ok := value.(reflect.Value)
 	if !ok {
 		reflectValue = reflect.ValueOf(value)
@@ -98,8 +434,10 @@ func (p *ModelField) Set(value interface{}) (err error) {
 
 			if reflectValue.Type().ConvertibleTo(fieldValue.Type()) {
 				fieldValue.Set(reflectValue.Convert(fieldValue.Type()))
+			} else if scanner, ok := fieldValue.Addr().Interface().(sql.Scanner); ok {
+				err = scanner.Scan(reflectValue.Interface())
 			} else {
-				err = fmt.Errorf("could not convert argument of field %s from %s to %s", p.Name, reflectValue.Type(), fieldValue.Type())
+				err = fmt.Errorf("could not convert argument of field %s from %s to %s", p.name, reflectValue.Type(), fieldValue.Type())
 			}
 		}
 	} else {
@@ -109,6 +447,208 @@ func (p *ModelField) Set(value interface{}) (err error) {
 	return err
 }
 
+// setDecimals leaves the field unchanged when the decimal does not fit
+func (p *ModelField) setDecimals(value interface{}) (err error) {
+	tmp := &ModelField{
+		name:       p.name,
+		fieldValue: reflect.New(p.fieldValue.Type()).Elem(),
+	}
+
+	if err = tmp.Set(value); err != nil {
+		return
+	}
+
+	if err = p.field.checkDecimals(tmp.fieldValue); err != nil {
+		return fmt.Errorf("invalid value of field %s, %w", p.name, err)
+	}
+
+	p.fieldValue.Set(tmp.fieldValue)
+
+	return
+}
+
+func (p *ModelField) coerceScalar(value interface{}) (coerced reflect.Value, err error) {
+	reflectValue, ok := value.(reflect.Value)
+	if !ok {
+		reflectValue = reflect.ValueOf(value)
+	}
+
+	typ := p.valueType()
+	if typ == nil {
+		return reflectValue, nil
+	}
+
+	coerced, err = p.field.scalar.coerce(reflectValue, typ)
+	if err != nil {
+		return
+	}
+
+	err = p.field.scalar.validateValue(coerced)
+
+	return
+}
+
+// valueType returns the type the field or the map entry holds
+func (p *ModelField) valueType() reflect.Type {
+	if p.mapValue.IsValid() {
+		return p.mapValue.Type().Elem()
+	}
+
+	if !p.fieldValue.IsValid() {
+		return nil
+	}
+
+	return p.fieldValue.Type()
+}
+
+// SetString parses s by the scalar of the field or by the kind of its
+// type and sets it, e.g. a value of a form or a csv cell
+func (p *ModelField) SetString(s string) (err error) {
+	return p.SetStrings([]string{s})
+}
+
+// nullable reports whether the field is a pointer or a sql.Null type
+func (p *ModelField) nullable() bool {
+	typ := p.valueType()
+	return typ != nil && (typ.Kind() == reflect.Ptr || sqlNullValueTypes[typ])
+}
+
+// SetStrings sets a slice field by every string parsed into its elements,
+// other fields are set by the first string, an empty string sets null to
+// pointers and sql.Null types
+func (p *ModelField) SetStrings(values []string) (err error) {
+
+	typ := p.valueType()
+	if typ == nil {
+		return errors.New("field value not valid")
+	}
+
+	if p.nullable() && len(values) > 0 && len(values[0]) == 0 {
+		return p.Set(nil)
+	}
+
+	if sqlNullValueTypes[typ] {
+		if len(values) == 0 {
+			return
+		}
+
+		value, parseErr := parseString(typ.Field(0).Type, values[0])
+		if parseErr != nil {
+			return fmt.Errorf("invalid value of field %s, %w", p.name, parseErr)
+		}
+
+		return p.Set(value)
+	}
+
+	if p.field != nil && p.field.scalar != nil {
+		if typ.Kind() == reflect.Slice {
+			return p.Set(values)
+		}
+		if len(values) == 0 {
+			return
+		}
+		return p.Set(values[0])
+	}
+
+	if typ.Kind() == reflect.Slice && typ != reflect.TypeOf(json.RawMessage{}) {
+		items := reflect.MakeSlice(typ, len(values), len(values))
+		for i := 0; i < len(values); i++ {
+			var item reflect.Value
+			if item, err = parseString(typ.Elem(), values[i]); err != nil {
+				return fmt.Errorf("invalid value of field %s, %w", p.name, err)
+			}
+			items.Index(i).Set(item)
+		}
+		return p.Set(items)
+	}
+
+	if len(values) == 0 {
+		return
+	}
+
+	value, err := parseString(typ, values[0])
+	if err != nil {
+		return fmt.Errorf("invalid value of field %s, %w", p.name, err)
+	}
+
+	return p.Set(value)
+}
+
+// Format returns the value as a string, scalars are written by their
+// Format functions
+func (p *ModelField) Format() (s string, err error) {
+
+	if !p.fieldValue.IsValid() {
+		return
+	}
+
+	value, null := nullValue(p.fieldValue)
+	if null {
+		return
+	}
+
+	if p.field != nil && p.field.scalar != nil && value.Type() == p.field.scalar.typ {
+		if value.IsZero() {
+			return
+		}
+		return p.field.scalar.format(value)
+	}
+
+	if value.Type() == typeOfTime {
+		s = value.Interface().(time.Time).Format(time.RFC3339)
+		return
+	}
+
+	s = fmt.Sprint(value.Interface())
+
+	return
+}
+
+// setMapEntry sets the map entry, a nil value deletes it
+func (p *ModelField) setMapEntry(value interface{}) (err error) {
+
+	reflectValue, ok := value.(reflect.Value)
+	if !ok {
+		reflectValue = reflect.ValueOf(value)
+	}
+
+	if !reflectValue.IsValid() {
+		if !p.mapValue.IsNil() {
+			p.mapValue.SetMapIndex(p.mapKey, reflect.Value{})
+		}
+		p.fieldValue = reflect.Value{}
+		return
+	}
+
+	elemType := p.mapValue.Type().Elem()
+
+	if !reflectValue.Type().ConvertibleTo(elemType) {
+		if elemType.Kind() == reflect.Ptr && reflectValue.Type().ConvertibleTo(elemType.Elem()) {
+			ptr := reflect.New(elemType.Elem())
+			ptr.Elem().Set(reflectValue.Convert(elemType.Elem()))
+			reflectValue = ptr
+		} else {
+			return fmt.Errorf("could not convert argument of field %s from %s to %s", p.name, reflectValue.Type(), elemType)
+		}
+	}
+
+	if p.mapValue.IsNil() {
+		if !p.mapValue.CanSet() {
+			return errors.New("using unaddressable value")
+		}
+		p.mapValue.Set(reflect.MakeMap(p.mapValue.Type()))
+	}
+
+	p.mapValue.SetMapIndex(p.mapKey, reflectValue.Convert(elemType))
+	p.fieldValue = p.mapValue.MapIndex(p.mapKey)
+
+	if elemType.Kind() == reflect.Struct {
+		p.fieldValue = copyEntry(elemType, p.fieldValue)
+	}
+
+	return
+}
+
 func (p *ModelField) Call(fn interface{}) (err error) {
 
 	if fn == nil {
@@ -200,3 +740,23 @@ func (p *ModelField) Call(fn interface{}) (err error) {
 
 	return
 }
+
+// promotedField returns a copy of the definition of the field name
+func promotedField(children []Field, name string) *Field {
+	for i := 0; i < len(children); i++ {
+		if children[i].Name == name {
+			field := children[i]
+			return &field
+		}
+	}
+
+	for i := 0; i < len(children); i++ {
+		if children[i].Anonymous && len(children[i].Type) == 0 {
+			if field := promotedField(children[i].Children, name); field != nil {
+				return field
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package dmod
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFieldSetMapEntries(t *testing.T) {
+	models, _ := NewModels()
+
+	err := models.LoadModels([]string{
+		`{"name":"address","fields":[{"name":"City","type":"string"},{"name":"Tags","type":"map[string]string"}]}`,
+		`{"name":"user","fields":[
+			{"name":"ByName","ref":"address","map":true},
+			{"name":"ByNameP","ref":"address","map":true,"pointer":true}
+		]}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, _ := models.GetModel("user")
+
+	v := user.New()
+
+	sets := map[string]string{
+		".ByName.home.City":      "Rome",
+		".ByName.home.Tags.zip":  "00100",
+		".ByNameP.home.City":     "Oslo",
+		".ByNameP.home.Tags.zip": "0150",
+	}
+
+	for path, value := range sets {
+		if err = user.Field(v, path).Set(value); err != nil {
+			t.Fatalf("set %s: %v", path, err)
+		}
+	}
+
+	if err = user.Field(v, ".ByName.home.City").Set("Paris"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := json.Marshal(v)
+
+	want := `{"ByName":{"home":{"City":"Paris","Tags":{"zip":"00100"}}},"ByNameP":{"home":{"City":"Oslo","Tags":{"zip":"0150"}}}}`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+
+	var city string
+	if err = user.Field(v, ".ByName.home.City").Value(&city); err != nil || city != "Paris" {
+		t.Errorf("value of map entry field got %q, %v", city, err)
+	}
+
+	if err = user.Field(v, ".ByName.home").Set(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ = json.Marshal(v)
+	if string(data) != `{"ByName":{},"ByNameP":{"home":{"City":"Oslo","Tags":{"zip":"0150"}}}}` {
+		t.Errorf("entry not deleted, got %s", data)
+	}
+}
+
+func TestFieldReadKeepsInstance(t *testing.T) {
+	models, _ := NewModels()
+
+	err := models.LoadModels([]string{
+		`{"name":"address","fields":[{"name":"City","type":"string"}]}`,
+		`{"name":"user","fields":[
+			{"name":"Home","ref":"address","pointer":true},
+			{"name":"ByName","ref":"address","map":true,"pointer":true},
+			{"name":"ByNameV","ref":"address","map":true}
+		]}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, _ := models.GetModel("user")
+
+	v := user.New()
+
+	before, _ := json.Marshal(v)
+
+	var city string
+	for _, path := range []string{"Home.City", "ByName.ghost.City", "ByName.ghost", "ByNameV.ghost.City"} {
+		field := user.Field(v, path)
+		if field == nil {
+			t.Fatalf("field %s not found", path)
+		}
+		if err = field.Value(&city); err != nil || city != "" {
+			t.Errorf("read %s got %q, %v", path, city, err)
+		}
+		if _, err = field.Format(); err != nil {
+			t.Errorf("format %s: %v", path, err)
+		}
+	}
+
+	after, _ := json.Marshal(v)
+	if string(after) != string(before) {
+		t.Fatalf("reads changed the instance from %s to %s", before, after)
+	}
+
+	home := user.Field(v, "Home.City")
+	ghost := user.Field(v, "ByName.ghost.City")
+
+	if err = home.Set("Rome"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ghost.Set("Oslo"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = user.Field(v, "Home.City").Value(&city); err != nil || city != "Rome" {
+		t.Errorf("set through a read field got %q, %v", city, err)
+	}
+
+	data, _ := json.Marshal(v)
+	if string(data) != `{"Home":{"City":"Rome"},"ByName":{"ghost":{"City":"Oslo"}},"ByNameV":{}}` {
+		t.Errorf("unexpected instance %s", data)
+	}
+}
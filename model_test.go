@@ -0,0 +1,156 @@
+package dmod
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+func TestModelEditPublishesGeneration(t *testing.T) {
+	models, _ := NewModels()
+
+	err := models.LoadModels([]string{`{"name":"user","fields":[{"name":"Name","type":"string"}]}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := models.Snapshot()
+	old, _ := snapshot.GetModel("user")
+
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			old.New()
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		model, effect, err := old.Insert("", []Field{{Name: "Age", Type: "int"}})
+		if err != nil || effect != 1 || model.Type().NumField() != 2 {
+			t.Errorf("insert got %v, %d, %v", model, effect, err)
+		}
+	}()
+
+	wg.Wait()
+
+	if old.Type().NumField() != 1 {
+		t.Fatalf("published model changed, %s", old.Type())
+	}
+
+	latest, _ := models.GetModel("user")
+	if latest.Type().NumField() != 2 {
+		t.Fatalf("edit not published, %s", latest.Type())
+	}
+
+	if models.Snapshot().Generation() != snapshot.Generation()+1 {
+		t.Fatalf("expect a new generation")
+	}
+
+	edited, _, err := old.Insert("", []Field{{Name: "Email", Type: "string"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latest, _ = models.GetModel("user")
+	if latest != edited || latest.Type().NumField() != 3 {
+		t.Fatalf("edit of a stale model should apply to the latest generation, %s", latest.Type())
+	}
+}
+
+func TestModelEditReturnsModel(t *testing.T) {
+	models, _ := NewModels()
+
+	err := models.LoadModels([]string{`{"name":"user","fields":[{"name":"Name","type":"string"},{"name":"Age","type":"int"}]}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, _ := models.GetModel("user")
+
+	user, deleted, err := user.Delete(".Age")
+	if err != nil || !deleted || user.Type().NumField() != 1 {
+		t.Fatalf("delete got %v, %v", deleted, err)
+	}
+
+	user, updated, err := user.Update(".Name", Field{Name: "Title", Type: "string"})
+	if err != nil || !updated || user.Type().Field(0).Name != "Title" {
+		t.Fatalf("update got %v, %v", updated, err)
+	}
+
+	user, updated, err = user.MergeTags(".Title", map[string]string{"db": "title"})
+	if err != nil || !updated || user.Type().Field(0).Tag.Get("db") != "title" {
+		t.Fatalf("merge tags got %v, %v, %s", updated, err, user.Type())
+	}
+
+	same, deleted, err := user.Delete(".Nope")
+	if err != nil || deleted || same != user {
+		t.Fatalf("delete of a missing field should return the latest model, got %v, %v", deleted, err)
+	}
+
+	if _, err = (&Model{name: "free"}).Combine(nil); err == nil {
+		t.Error("expect an error for a model not registered")
+	}
+}
+
+func TestAbstractAndInternalModels(t *testing.T) {
+	models, _ := NewModels()
+
+	err := models.LoadModels([]string{
+		`{"name":"base","abstract":true,"fields":[{"name":"ID","type":"uint"}]}`,
+		`{"name":"audit","internal":true,"fields":[{"name":"By","type":"string"}]}`,
+		`{"name":"user","extends":[{"model":"base","embed":true}],"fields":[{"name":"Audit","ref":"audit"}]}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := models.ProduceByName("base"); v != nil {
+		t.Errorf("abstract model should not be produced, got %v", v)
+	}
+
+	base, exist := models.GetModel("base")
+	if !exist || !base.Abstract() {
+		t.Fatal("abstract model should be found by GetModel")
+	}
+
+	if v := models.Produce(base); v != nil {
+		t.Errorf("abstract model should not be produced, got %v", v)
+	}
+
+	if v := models.ProduceByName("user"); v == nil {
+		t.Error("user should be produced")
+	}
+
+	audit, exist := models.GetModel("audit")
+	if !exist || !audit.Internal() {
+		t.Fatal("internal model should be found by GetModel")
+	}
+
+	if v := models.ProduceByName("audit"); v == nil {
+		t.Error("internal model should be produced")
+	}
+
+	for _, model := range models.Models() {
+		if model.Name() == "audit" {
+			t.Error("internal model should be hidden from Models()")
+		}
+	}
+
+	dumped := map[string]json.RawMessage{}
+	if err = json.Unmarshal([]byte(models.Dump()), &dumped); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, exist := dumped["audit"]; exist {
+		t.Error("internal model should be hidden from Dump()")
+	}
+
+	if _, exist := dumped["user"]; !exist {
+		t.Error("user should be dumped")
+	}
+}
@@ -1,37 +1,40 @@
 package dmod
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io/fs"
 	"os"
-	"path/filepath"
 	"reflect"
-	"strings"
+	"sort"
+	"strconv"
 	"sync"
-
-	"github.com/sirupsen/logrus"
+	"sync/atomic"
 )
 
+// Models is the registry of models, readers always see the latest published
+// Snapshot without blocking, writers are serialized by locker and publish a
+// new generation when they succeed
 type Models struct {
 	locker sync.Mutex
 
-	modelsInstance map[string]*Model
-	combineMapper  CombineMapper
-	builder        StructBuilder
+	snapshot      atomic.Value
+	combineMapper CombineMapper
+	builder       StructBuilder
 
-	modelsConfig map[string]*ModelConfig
+	// dirPackages puts the models of sub directories into packages
+	dirPackages bool
 }
 
 type ModelsOption func(*Models) error
 
 func NewModels(opts ...ModelsOption) (models *Models, err error) {
 	m := &Models{
-		modelsInstance: make(map[string]*Model),
-		combineMapper:  NewBasicMapper(),
-		builder:        defaultBuilder,
+		combineMapper: NewBasicMapper(),
+		builder:       defaultBuilder,
 	}
 
+	m.snapshot.Store(newSnapshot(0, map[string]*Model{}, map[string]*ModelConfig{}, map[string]*Enum{}))
+
 	for i := 0; i < len(opts); i++ {
 		err = opts[i](m)
 		if err != nil {
@@ -58,25 +61,99 @@ func ModelsOptBuilder(builder StructBuilder) ModelsOption {
 	}
 }
 
-func (p *Models) Flush() {
-	p.locker.Lock()
-	p.modelsConfig = map[string]*ModelConfig{}
-	p.modelsInstance = map[string]*Model{}
-	p.locker.Unlock()
+// ModelsOptTagPolicies applies the tag policies to every field built by
+// the models, e.g. TagPolicy{Key: "json", Naming: SnakeCase}
+func ModelsOptTagPolicies(policies ...TagPolicy) ModelsOption {
+	return func(m *Models) error {
+		builder, ok := m.builder.(interface {
+			WithTagPolicies(policies ...TagPolicy) StructBuilder
+		})
+
+		if !ok {
+			return fmt.Errorf("builder %T does not support tag policies", m.builder)
+		}
+
+		m.builder = builder.WithTagPolicies(policies...)
+		return nil
+	}
 }
 
-func (p *Models) Dump() string {
+// ModelsOptNormalizeNames converts field names which are not exported go
+// identifiers by PascalCase, e.g. `first_name` becomes `FirstName` with
+// `json:"first_name"`, names which could not be fixed are still errors
+func ModelsOptNormalizeNames() ModelsOption {
+	return func(m *Models) error {
+		builder, ok := m.builder.(interface {
+			WithNameNormalization() StructBuilder
+		})
 
-	allModels := map[string]ModelConfig{}
+		if !ok {
+			return fmt.Errorf("builder %T does not support name normalization", m.builder)
+		}
 
-	for k, v := range p.modelsInstance {
-		copyConf := v.config
-		copyConf.reset()
-		allModels[k] = copyConf
+		m.builder = builder.WithNameNormalization()
+		return nil
+	}
+}
+
+// ModelsOptDirPackages puts the models loaded from a directory into the
+// packages named by their sub directories, e.g. `billing/address.json`
+// declares `billing.address`, a `package` key of the model wins
+func ModelsOptDirPackages() ModelsOption {
+	return func(m *Models) error {
+		m.dirPackages = true
+		return nil
+	}
+}
+
+// ModelsOptNullStrategy builds fields with `nullable: true` by strategy,
+// the default strategy is NullPointer
+func ModelsOptNullStrategy(strategy NullStrategy) ModelsOption {
+	return func(m *Models) error {
+		builder, ok := m.builder.(interface {
+			WithNullStrategy(strategy NullStrategy) StructBuilder
+		})
+
+		if !ok {
+			return fmt.Errorf("builder %T does not support null strategy", m.builder)
+		}
+
+		m.builder = builder.WithNullStrategy(strategy)
+		return nil
 	}
+}
+
+// Snapshot returns the current generation of models, it is never changed
+// by later loads, hold it to get a consistent view for a whole request
+func (p *Models) Snapshot() *Snapshot {
+	return p.snapshot.Load().(*Snapshot)
+}
+
+// publish stores a new generation, the caller must hold locker
+func (p *Models) publish(instances map[string]*Model, configs map[string]*ModelConfig, enums map[string]*Enum) {
+	p.snapshot.Store(newSnapshot(p.Snapshot().Generation()+1, instances, configs, enums))
+}
+
+// replaceModel publishes model in a new generation, the caller must hold locker
+func (p *Models) replaceModel(model *Model) {
+	current := p.Snapshot()
+
+	instances := current.copyModelsInstance()
+	instances[model.name] = model
+	model.registry = instances
 
-	dumpData, _ := json.MarshalIndent(allModels, "", "    ")
-	return string(dumpData)
+	p.publish(instances, current.modelsConfig, current.enums)
+}
+
+func (p *Models) Flush() {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.publish(map[string]*Model{}, map[string]*ModelConfig{}, map[string]*Enum{})
+}
+
+func (p *Models) Dump() string {
+	return p.Snapshot().Dump()
 }
 
 func (p *Models) DeleteModel(name string) bool {
@@ -84,292 +161,385 @@ func (p *Models) DeleteModel(name string) bool {
 	p.locker.Lock()
 	defer p.locker.Unlock()
 
-	_, exist := p.modelsConfig[name]
+	current := p.Snapshot()
+
+	_, exist := current.modelsInstance[name]
 	if !exist {
 		return false
 	}
 
-	delete(p.modelsConfig, name)
-	delete(p.modelsInstance, name)
+	instances := current.copyModelsInstance()
+	delete(instances, name)
+
+	configs := map[string]*ModelConfig{}
+	for k, v := range current.modelsConfig {
+		if k != name {
+			configs[k] = v
+		}
+	}
+
+	p.publish(instances, configs, current.enums)
 
 	return true
 }
 
 func (p *Models) LoadModels(modleSchemas []string) (err error) {
 
-	allModels := map[string]*ModelConfig{}
-
-	for k, v := range p.modelsConfig {
-		copyModel := *v
-		copyModel.reset()
-		allModels[k] = &copyModel
-	}
+	p.locker.Lock()
+	defer p.locker.Unlock()
 
-	for _, schema := range modleSchemas {
+	allModels := p.Snapshot().copyModelsConfig()
+	allEnums := p.Snapshot().copyEnumsConfig()
 
-		modelConfig := ModelConfig{}
+	loaded := map[string]string{}
 
-		err = json.Unmarshal([]byte(schema), &modelConfig)
-		if err != nil {
-			return
-		}
+	var errs SchemaErrors
 
-		modelConfig.originalFields = modelConfig.Fields
+	for i, schema := range modleSchemas {
 
-		_, existModel := allModels[modelConfig.Name]
-		if existModel {
-			logrus.WithField("model", modelConfig.Name).Warnln("model already exist")
+		modelConfigs, enumConfigs, decodeErr := decodeModelConfigs("", "", []byte(schema))
+		if decodeErr != nil {
+			errs.add(decodeErr)
+			continue
 		}
 
-		allModels[modelConfig.Name] = &modelConfig
-		logrus.WithField("model", modelConfig.Name).Debug("model loaded")
+		addEnumConfigs(allEnums, enumConfigs)
+		addModelConfigs(allModels, loaded, modelConfigs, "schema "+strconv.Itoa(i), &errs)
 	}
 
-	if err != nil {
+	if len(errs) > 0 {
+		err = errs
 		return
 	}
 
-	for _, model := range allModels {
-		for i := 0; i < len(model.Fields); i++ {
-			fieldRefUpdate(allModels, model, &model.Fields[i])
-		}
-	}
+	err = p.commitModels(allModels, allEnums)
 
-	for _, model := range allModels {
-		modelExtendsUpdate(allModels, model)
-	}
+	return
+}
+
+func (p *Models) LoadFromFiles(files ...string) (err error) {
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	allModels := p.Snapshot().copyModelsConfig()
+	allEnums := p.Snapshot().copyEnumsConfig()
 
-	p.modelsConfig = allModels
+	loaded := map[string]string{}
 
-	for _, model := range allModels {
-		_, err = p.SetModel(*model)
+	var errs SchemaErrors
+
+	for _, file := range files {
+		err = readModelFile(osFS{}, file, file, "", allModels, loaded, allEnums, &errs)
 		if err != nil {
 			return
 		}
 	}
 
+	if len(errs) > 0 {
+		err = errs
+		return
+	}
+
+	err = p.commitModels(allModels, allEnums)
+
 	return
 }
 
-func (p *Models) LoadFromFiles(files ...string) (err error) {
+func (p *Models) LoadFromDir(dir string) (err error) {
+	return p.loadFromFS(os.DirFS(dir), ".", dir)
+}
+
+// LoadFromFS loads every model file under root of fsys, hidden directories
+// are skipped, it could be used with embed.FS, zip.Reader or fstest.MapFS
+func (p *Models) LoadFromFS(fsys fs.FS, root string) (err error) {
+	return p.loadFromFS(fsys, root, "")
+}
+
+// loadFromFS records the path of files as dir joined with their name in fsys
+func (p *Models) loadFromFS(fsys fs.FS, root, dir string) (err error) {
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
 
 	allModels := map[string]*ModelConfig{}
+	allEnums := map[string]*EnumConfig{}
+
+	loaded := map[string]string{}
+
+	var errs SchemaErrors
 
-	for k, v := range p.modelsConfig {
-		copyModel := *v
-		copyModel.reset()
-		allModels[k] = &copyModel
+	err = walkModelFiles(fsys, root, func(name string, d fs.DirEntry) error {
+		return readModelFile(fsys, name, joinModelPath(dir, name), p.dirPackage(root, name), allModels, loaded, allEnums, &errs)
+	})
+
+	if err != nil {
+		return
 	}
 
-	for _, file := range files {
+	if len(errs) > 0 {
+		err = errs
+		return
+	}
 
-		logrus.WithField("file", file).Debug("begin load")
+	err = p.commitModels(allModels, allEnums)
 
-		var data []byte
+	return
+}
 
-		data, err = ioutil.ReadFile(file)
-		if err != nil {
-			return
-		}
+func (p *Models) NewModel(config ModelConfig) (model *Model, err error) {
 
-		modelConfig := ModelConfig{}
+	p.locker.Lock()
+	defer p.locker.Unlock()
 
-		err = json.Unmarshal(data, &modelConfig)
-		if err != nil {
-			return
-		}
+	current := p.Snapshot()
 
-		modelConfig.filepath = file
-		modelConfig.originalFields = modelConfig.Fields
+	config.qualify("")
+	config.mergeExtends()
 
-		_, existModel := allModels[modelConfig.Name]
-		if existModel {
-			logrus.WithField("model", modelConfig.Name).WithField("file", file).Warnln("model already exist")
-		}
+	_, exist := current.modelsInstance[config.Name]
 
-		allModels[modelConfig.Name] = &modelConfig
-		logrus.WithField("file", file).WithField("model", modelConfig.Name).Debug("model loaded")
+	if exist {
+		err = fmt.Errorf("model %s already exist", config.Name)
+		return
 	}
 
+	allModels := current.copyModelsConfig()
+
+	config.originalFields = config.Fields
+	allModels[config.Name] = &config
+
+	err = resolveModelConfigs(allModels, current.enums)
 	if err != nil {
 		return
 	}
 
-	for _, model := range allModels {
-		for i := 0; i < len(model.Fields); i++ {
-			fieldRefUpdate(allModels, model, &model.Fields[i])
-		}
-	}
-
-	for _, model := range allModels {
-		modelExtendsUpdate(allModels, model)
+	model, err = p.buildModel(config)
+	if err != nil {
+		err = buildError(&config, err)
+		return
 	}
 
-	p.modelsConfig = allModels
+	instances := current.copyModelsInstance()
+	instances[config.Name] = model
+	model.registry = instances
 
-	for _, model := range allModels {
-		_, err = p.SetModel(*model)
-		if err != nil {
-			return
-		}
-	}
+	p.publish(instances, allModels, current.enums)
 
 	return
 }
 
-func (p *Models) LoadFromDir(dir string) (err error) {
+func (p *Models) GetModel(name string) (*Model, bool) {
+	return p.Snapshot().GetModel(name)
+}
 
-	allModels := map[string]*ModelConfig{}
+func (p *Models) Models() []*Model {
+	return p.Snapshot().Models()
+}
 
-	walkFn := func(path string, info os.FileInfo, e error) (walkErr error) {
+func (p *Models) GetEnum(name string) (*Enum, bool) {
+	return p.Snapshot().GetEnum(name)
+}
 
-		if info.IsDir() {
-			if strings.HasPrefix(filepath.Base(path), ".") {
-				return filepath.SkipDir
-			}
-			return
-		}
+func (p *Models) Enums() []*Enum {
+	return p.Snapshot().Enums()
+}
 
-		if filepath.Ext(path) != ".json" {
-			return
-		}
+func (p *Models) SetModel(config ModelConfig) (model *Model, err error) {
 
-		relPath, _ := filepath.Rel(dir, path)
+	config.qualify("")
+	config.mergeExtends()
 
-		logrus.WithField("file", relPath).Debug("begin load")
+	model, err = p.buildModel(config)
+	if err != nil {
+		err = buildError(&config, err)
+		return
+	}
 
-		data, walkErr := ioutil.ReadFile(path)
-		if walkErr != nil {
-			return
-		}
+	p.locker.Lock()
+	defer p.locker.Unlock()
 
-		modelConfig := ModelConfig{}
+	current := p.Snapshot()
 
-		walkErr = json.Unmarshal(data, &modelConfig)
-		if walkErr != nil {
-			return
-		}
+	instances := current.copyModelsInstance()
+	instances[config.Name] = model
+	model.registry = instances
 
-		modelConfig.filepath = path
-		modelConfig.originalFields = modelConfig.Fields
+	p.publish(instances, current.modelsConfig, current.enums)
 
-		_, existModel := allModels[modelConfig.Name]
-		if existModel {
-			logrus.WithField("model", modelConfig.Name).WithField("file", path).Warnln("model already exist")
-		}
+	return
+}
 
-		allModels[modelConfig.Name] = &modelConfig
-		logrus.WithField("file", relPath).WithField("model", modelConfig.Name).Debug("model loaded")
+// buildError wraps the error of building config into a SchemaError
+func buildError(config *ModelConfig, err error) *SchemaError {
+	if schemaErr, ok := err.(*SchemaError); ok {
+		return schemaErr
+	}
 
-		return
+	return &SchemaError{
+		Kind:  SchemaErrBuild,
+		Model: config.Name,
+		File:  config.filepath,
+		Line:  config.line,
+		Err:   err,
 	}
+}
 
-	err = filepath.Walk(dir, walkFn)
+// commitModels publishes allModels only if all of them are built, the caller must hold locker
+func (p *Models) commitModels(allModels map[string]*ModelConfig, allEnums map[string]*EnumConfig) (err error) {
 
+	enums, err := buildEnums(allEnums, p.lookupType)
 	if err != nil {
 		return
 	}
 
-	for _, model := range allModels {
-		for i := 0; i < len(model.Fields); i++ {
-			fieldRefUpdate(allModels, model, &model.Fields[i])
-		}
+	err = resolveModelConfigs(allModels, enums)
+	if err != nil {
+		return
 	}
 
-	for _, model := range allModels {
-		modelExtendsUpdate(allModels, model)
+	var names []string
+	for name := range allModels {
+		names = append(names, name)
 	}
 
-	p.modelsConfig = allModels
+	built, err := p.buildModels(allModels, names)
+	if err != nil {
+		return
+	}
 
-	for _, model := range allModels {
-		_, err = p.SetModel(*model)
-		if err != nil {
-			return
-		}
+	staging := p.Snapshot().copyModelsInstance()
+
+	for name, model := range built {
+		staging[name] = model
+		model.registry = staging
 	}
 
+	p.publish(staging, allModels, enums)
+
 	return
 }
 
-func (p *Models) NewModel(config ModelConfig) (model *Model, err error) {
+// buildModels builds the named models of allModels and collects their errors
+func (p *Models) buildModels(allModels map[string]*ModelConfig, names []string) (built map[string]*Model, err error) {
 
-	_, exist := p.modelsInstance[config.Name]
+	sort.Strings(names)
 
-	if exist {
-		err = fmt.Errorf("model %s already exist", config.Name)
-		return
-	}
+	staging := map[string]*Model{}
 
-	m, err := p.SetModel(config)
-	if err != nil {
-		return
-	}
+	var errs SchemaErrors
 
-	model = m
+	for _, name := range names {
+		config := allModels[name]
 
-	for _, model := range p.modelsConfig {
-		for i := 0; i < len(model.Fields); i++ {
-			fieldRefUpdate(p.modelsConfig, model, &model.Fields[i])
+		if len(config.Params) > 0 {
+			continue
 		}
+
+		model, buildErr := p.buildModel(*config)
+		if buildErr != nil {
+			errs.add(buildError(config, buildErr))
+			continue
+		}
+
+		staging[name] = model
 	}
 
-	for _, model := range p.modelsConfig {
-		modelExtendsUpdate(p.modelsConfig, model)
+	if len(errs) > 0 {
+		err = errs
+		return
 	}
 
+	built = staging
+
 	return
 }
 
-func (p *Models) GetModel(name string) (*Model, bool) {
-	m, e := p.modelsInstance[name]
-	return m, e
-}
+// combineMapOf returns the combine map of the model with its embedded parents
+func (p *Models) combineMapOf(name string, fields []Field) (combineMap map[string]interface{}) {
 
-func (p *Models) Models() []*Model {
-	var models []*Model
+	if mapperFn, exist := p.CombineMapper().GetMapper(name); exist {
+		combineMap = mapperFn(name, fields)
+	}
+
+	for i := 0; i < len(fields); i++ {
+		if len(fields[i].embed) == 0 {
+			continue
+		}
 
-	for _, v := range p.modelsInstance {
-		models = append(models, v)
+		for path, v := range p.combineMapOf(fields[i].embed, fields[i].Children) {
+			if combineMap == nil {
+				combineMap = map[string]interface{}{}
+			}
+
+			embedPath := "." + fields[i].Name
+			if path != "." {
+				embedPath += path
+			}
+
+			if _, exist := combineMap[embedPath]; !exist {
+				combineMap[embedPath] = v
+			}
+		}
 	}
 
-	return models
+	return
 }
 
-func (p *Models) SetModel(config ModelConfig) (model *Model, err error) {
+func (p *Models) buildModel(config ModelConfig) (model *Model, err error) {
 	if len(config.Name) == 0 {
 		err = fmt.Errorf("name is empty")
 		return
 	}
 
-	p.locker.Lock()
-	defer p.locker.Unlock()
-
-	mapperFn, exist := p.CombineMapper().GetMapper(config.Name)
-	var combineMap map[string]interface{}
-	if exist {
-		combineMap = mapperFn(config.Name, config.Fields)
+	if len(config.Params) > 0 {
+		err = fmt.Errorf("model %s is generic, instantiate it instead", config.Name)
+		return
 	}
 
+	combineMap := p.combineMapOf(config.Name, config.Fields)
+
+	fields := builderFields(p.builder, config.Fields)
+
+	annotateScalars(fields, p.builder)
+
 	var structFields []reflect.StructField
-	structFields, err = p.builder.Build(config.Fields, combineMap)
+	structFields, err = p.builder.Build(fields, combineMap)
+
+	if schemaErr, ok := err.(*SchemaError); ok {
+		schemaErr.Model = config.Name
+		schemaErr.File = config.filepath
+		schemaErr.Line = config.line
+	}
+
+	if err != nil {
+		return
+	}
+
+	structOf, err := structOf(structFields)
+	if err != nil {
+		return
+	}
 
+	refs, err := collectRefBindings(fields, structOf, nil)
 	if err != nil {
 		return
 	}
 
 	model = &Model{
 		name:         config.Name,
-		fields:       config.Fields,
+		fields:       fields,
 		builder:      p.builder,
 		structFields: structFields,
 		combineMap:   combineMap,
 		config:       config,
-		structOf:     reflect.StructOf(structFields),
+		structOf:     structOf,
+		refs:         refs,
+		unions:       hasUnions(fields),
+		shadows:      &sync.Map{},
+		owner:        p,
 	}
 
-	p.modelsInstance[config.Name] = model
-
 	return
 }
 
@@ -382,16 +552,34 @@ func (p *Models) Produce(model *Model, values ...interface{}) interface{} {
 }
 
 func (p *Models) ProduceByName(name string, values ...interface{}) interface{} {
-	if len(name) == 0 {
-		return nil
+	return p.Snapshot().ProduceByName(name, values...)
+}
+
+// lookupType looks name up in the builder
+func (p *Models) lookupType(name string) (typ reflect.Type, exist bool) {
+	if builder, ok := p.builder.(*Builder); ok {
+		return builder.lookupType(name)
 	}
 
-	model, exist := p.GetModel(name)
-	if !exist {
-		return nil
+	typ, exist = typeMap[name]
+	return
+}
+
+// RegisterScalars registers the scalars to the builder, models loaded
+// later could use them as types
+func (p *Models) RegisterScalars(scalars ...Scalar) (err error) {
+	builder, ok := p.builder.(interface {
+		RegisterScalars(scalars ...Scalar)
+	})
+
+	if !ok {
+		err = fmt.Errorf("builder %T does not support scalars", p.builder)
+		return
 	}
 
-	return model.New(values...)
+	builder.RegisterScalars(scalars...)
+
+	return
 }
 
 func (p *Models) CombineMapper() CombineMapper {
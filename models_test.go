@@ -0,0 +1,87 @@
+package dmod
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFailedLoadKeepsGeneration(t *testing.T) {
+	models, _ := NewModels()
+
+	err := models.LoadModels([]string{`{"name":"user","fields":[{"name":"Name","type":"string"}]}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := models.Snapshot()
+	user, _ := before.GetModel("user")
+
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "broken.json")
+	if err = os.WriteFile(broken, []byte(`{"name":"order","fields":[{"name":"Buyer","ref":"buyer"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	good := filepath.Join(dir, "order.json")
+	if err = os.WriteFile(good, []byte(`{"name":"order","fields":[{"name":"ID","type":"int"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loads := map[string]func() error{
+		"missing ref": func() error {
+			return models.LoadModels([]string{`{"name":"order","fields":[{"name":"Buyer","ref":"buyer"}]}`})
+		},
+		"redefined model": func() error {
+			return models.LoadModels([]string{`{"name":"user","fields":[{"name":"Name","type":"no.such.type"}]}`})
+		},
+		"broken file": func() error {
+			return models.LoadFromFiles(broken)
+		},
+		"missing file": func() error {
+			return models.LoadFromFiles(good, filepath.Join(dir, "missing.json"))
+		},
+		"broken fs": func() error {
+			return models.LoadFromFS(fstest.MapFS{"a.json": {Data: []byte(`{"name":`)}}, ".")
+		},
+	}
+
+	for name, load := range loads {
+		err = load()
+		if err == nil {
+			t.Errorf("%s should fail", name)
+			continue
+		}
+
+		var errs SchemaErrors
+		if name != "missing file" && !errors.As(err, &errs) {
+			t.Errorf("%s should return SchemaErrors, got %T %v", name, err, err)
+		}
+
+		if models.Snapshot() != before {
+			t.Errorf("%s should keep the previous generation", name)
+		}
+
+		if latest, _ := models.GetModel("user"); latest != user {
+			t.Errorf("%s should keep the previous models", name)
+		}
+
+		if _, exist := models.GetModel("order"); exist {
+			t.Errorf("%s should not register models of the failed load", name)
+		}
+	}
+
+	if err = models.LoadModels([]string{`{"name":"buyer","fields":[{"name":"Name","type":"string"}]}`}); err != nil {
+		t.Fatal(err)
+	}
+
+	if models.Snapshot().Generation() != before.Generation()+1 {
+		t.Errorf("generation got %d, want %d", models.Snapshot().Generation(), before.Generation()+1)
+	}
+
+	if _, exist := before.GetModel("buyer"); exist {
+		t.Error("a held snapshot should not change")
+	}
+}
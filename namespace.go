@@ -0,0 +1,216 @@
+package dmod
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// qualifiedName returns name in the package pkg, e.g. `billing.address`,
+// names already qualified by pkg are kept
+func qualifiedName(pkg, name string) string {
+	if len(pkg) == 0 || len(name) == 0 || strings.HasPrefix(name, pkg+".") {
+		return name
+	}
+	return pkg + "." + name
+}
+
+// dirPackage returns the package of the model file name under root, it is
+// the directory of the file relative to root joined by dots, e.g. `billing`
+// for `billing/address.json`, it is empty unless ModelsOptDirPackages is used
+func (p *Models) dirPackage(root, name string) string {
+	if !p.dirPackages {
+		return ""
+	}
+
+	dir := path.Dir(name)
+
+	if root != "." && len(root) > 0 {
+		root = strings.TrimSuffix(root, "/")
+		if dir == root {
+			return ""
+		}
+		dir = strings.TrimPrefix(dir, root+"/")
+	}
+
+	if dir == "." {
+		return ""
+	}
+
+	return strings.ReplaceAll(dir, "/", ".")
+}
+
+// namespace resolves the names used by a model, a name is looked up in the
+// package of the model first, then as `pkg.name` of an imported package,
+// which could be named by its last element, e.g. `billing.address` for the
+// import `acme.billing`, at last as it is, a model of another package must
+// be imported to be used
+type namespace struct {
+	models  map[string]*ModelConfig
+	model   *ModelConfig
+	imports map[string]string
+	params  map[string]bool
+}
+
+// qualifyModels replaces the names used by the refs, types, unions and
+// extends of models with the qualified names of the models they denote,
+// missing imports and models of packages not imported are errors
+func qualifyModels(models map[string]*ModelConfig) (errs SchemaErrors) {
+
+	packages := map[string]bool{}
+
+	var names []string
+	for name, model := range models {
+		names = append(names, name)
+		if len(model.Package) > 0 {
+			packages[model.Package] = true
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		model := models[name]
+
+		if len(model.template) > 0 {
+			continue
+		}
+
+		ns := &namespace{
+			models:  models,
+			model:   model,
+			imports: map[string]string{},
+			params:  map[string]bool{},
+		}
+
+		for _, param := range model.Params {
+			ns.params[param] = true
+		}
+
+		for _, imp := range model.Imports {
+			if !packages[imp] {
+				errs.add(&SchemaError{
+					Kind:   SchemaErrImport,
+					Model:  model.Name,
+					File:   model.filepath,
+					Line:   model.line,
+					Target: imp,
+					Err:    fmt.Errorf("package %s not exist", imp),
+				})
+				continue
+			}
+
+			ns.imports[imp] = imp
+			ns.imports[imp[strings.LastIndex(imp, ".")+1:]] = imp
+		}
+
+		if len(model.ExtendOptions) > 0 {
+			extends := make([]Extend, len(model.ExtendOptions))
+			for i, extend := range model.ExtendOptions {
+				extend.Model = ns.qualifyType(&errs, "", extend.Model)
+				extends[i] = extend
+			}
+			model.ExtendOptions = extends
+			model.Extends = extendNames(extends)
+		}
+
+		ns.qualifyFields(&errs, "", model.originalFields)
+	}
+
+	return
+}
+
+func (p *namespace) qualifyFields(errs *SchemaErrors, parent string, fields []Field) {
+	for i := 0; i < len(fields); i++ {
+		path := parent + "." + fields[i].Name
+
+		fields[i].Type = p.qualifyType(errs, path, fields[i].Type)
+		fields[i].Ref = p.qualifyType(errs, path, fields[i].Ref)
+
+		if len(fields[i].OneOf) > 0 {
+			variants := make([]string, len(fields[i].OneOf))
+			for j, variant := range fields[i].OneOf {
+				variants[j] = p.qualifyType(errs, path, variant)
+			}
+			fields[i].OneOf = variants
+		}
+
+		p.qualifyFields(errs, path, fields[i].Children)
+	}
+}
+
+// qualifyType qualifies every model named by the type expression src, it
+// is kept as it is when no name is changed
+func (p *namespace) qualifyType(errs *SchemaErrors, path, src string) string {
+	if len(src) == 0 {
+		return src
+	}
+
+	expr, err := parseTypeExpr(src)
+	if err != nil {
+		return src
+	}
+
+	changed := false
+
+	qualified := expr.rename(func(name string) string {
+		target, err := p.resolve(name)
+		if err != nil {
+			errs.add(&SchemaError{
+				Kind:   SchemaErrImport,
+				Model:  p.model.Name,
+				Field:  path,
+				File:   p.model.filepath,
+				Line:   p.model.line,
+				Target: name,
+				Err:    err,
+			})
+			return name
+		}
+
+		if target != name {
+			changed = true
+		}
+
+		return target
+	})
+
+	if !changed {
+		return src
+	}
+
+	return qualified.String()
+}
+
+// resolve returns the qualified name of the model denoted by name, names
+// which are not models, e.g. `int` or `time.Time`, are kept
+func (p *namespace) resolve(name string) (string, error) {
+
+	if p.params[name] {
+		return name, nil
+	}
+
+	if len(p.model.Package) > 0 {
+		if _, exist := p.models[p.model.Package+"."+name]; exist {
+			return p.model.Package + "." + name, nil
+		}
+	}
+
+	if i := strings.LastIndex(name, "."); i > 0 {
+		if imp, exist := p.imports[name[:i]]; exist {
+			return imp + name[i:], nil
+		}
+	}
+
+	target, exist := p.models[name]
+	if !exist || len(target.Package) == 0 || target.Package == p.model.Package {
+		return name, nil
+	}
+
+	if _, imported := p.imports[target.Package]; !imported {
+		return name, fmt.Errorf("package %s is not imported", target.Package)
+	}
+
+	return name, nil
+}
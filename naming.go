@@ -0,0 +1,171 @@
+package dmod
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// splitWords splits an identifier into words, both `FirstName`,
+// `first_name` and `HTTPServer` are understood, other characters than
+// letters and digits separate words, e.g. `page<user>`
+func splitWords(name string) []string {
+	var words []string
+	var current []rune
+
+	runes := []rune(name)
+
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, string(current))
+			current = nil
+		}
+	}
+
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+
+		if unicode.IsUpper(r) && len(current) > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				flush()
+			}
+		}
+
+		current = append(current, r)
+	}
+
+	flush()
+
+	return words
+}
+
+// SnakeCase converts `UserID` to `user_id`
+func SnakeCase(name string) string {
+	words := splitWords(name)
+
+	for i := 0; i < len(words); i++ {
+		words[i] = strings.ToLower(words[i])
+	}
+
+	return strings.Join(words, "_")
+}
+
+// CamelCase converts `UserID` to `userId`
+func CamelCase(name string) string {
+	words := splitWords(name)
+
+	for i := 0; i < len(words); i++ {
+		word := []rune(strings.ToLower(words[i]))
+		if i > 0 {
+			word[0] = unicode.ToUpper(word[0])
+		}
+		words[i] = string(word)
+	}
+
+	return strings.Join(words, "")
+}
+
+// PascalCase converts `first_name` to `FirstName`, the letters of a word
+// other than the first one are kept, so `userID` is `UserID`
+func PascalCase(name string) string {
+	words := splitWords(name)
+
+	for i := 0; i < len(words); i++ {
+		word := []rune(words[i])
+		word[0] = unicode.ToUpper(word[0])
+		words[i] = string(word)
+	}
+
+	return strings.Join(words, "")
+}
+
+// checkName reports why name could not be the name of a struct field
+func checkName(name string) error {
+	if len(name) == 0 {
+		return fmt.Errorf("name is empty")
+	}
+
+	for i, r := range name {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return fmt.Errorf("name %q is not a go identifier", name)
+		}
+	}
+
+	if r, _ := utf8.DecodeRuneInString(name); !unicode.IsUpper(r) {
+		return fmt.Errorf("name %q is not exported, it must start with an upper case letter", name)
+	}
+
+	return nil
+}
+
+// normalizeFieldNames returns a copy of fields with invalid names converted
+// by PascalCase, the original name is kept as the json tag, e.g.
+// `first_name` becomes `FirstName` with `json:"first_name"`
+func normalizeFieldNames(fields []Field) []Field {
+	fields = copyFields(fields)
+	renameFields(fields)
+	return fields
+}
+
+func renameFields(fields []Field) {
+	for i := 0; i < len(fields); i++ {
+		field := &fields[i]
+
+		if checkName(field.Name) != nil {
+			if name := PascalCase(field.Name); checkName(name) == nil {
+				if _, exist := field.GetTag("json"); !exist {
+					field.SetTag("json", field.Name)
+				}
+				field.Name = name
+			}
+		}
+
+		renameFields(field.Children)
+	}
+}
+
+// builderFields returns fields as they are named by the structs of builder,
+// so models find the struct fields by the same names
+func builderFields(builder StructBuilder, fields []Field) []Field {
+	if b, ok := builder.(interface {
+		normalizeFields(fields []Field) []Field
+	}); ok {
+		return b.normalizeFields(fields)
+	}
+	return fields
+}
+
+// checkFieldNames checks the names of fields and their children
+func checkFieldNames(fields []Field, path string) (err error) {
+
+	names := make(map[string]bool, len(fields))
+
+	for i := 0; i < len(fields); i++ {
+		field := &fields[i]
+
+		fieldPath := path + "." + field.Name
+
+		if err = checkName(field.Name); err != nil {
+			return &SchemaError{Kind: SchemaErrName, Field: fieldPath, Err: err}
+		}
+
+		if names[field.Name] {
+			return &SchemaError{Kind: SchemaErrName, Field: fieldPath, Err: fmt.Errorf("duplicate field %s", field.Name)}
+		}
+
+		names[field.Name] = true
+
+		if err = checkFieldNames(field.Children, fieldPath); err != nil {
+			return
+		}
+	}
+
+	return
+}
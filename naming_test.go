@@ -0,0 +1,45 @@
+package dmod
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeNamesKeepsSchema(t *testing.T) {
+	models, _ := NewModels(ModelsOptNormalizeNames())
+
+	err := models.LoadModels([]string{
+		`{"name":"address","fields":[{"name":"zip_code","type":"string"}]}`,
+		`{"name":"user","fields":[{"name":"first_name","type":"string"},{"name":"home","ref":"address"}]}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, _ := models.GetModel("user")
+
+	v := user.New()
+	if err = user.Field(v, "Home.ZipCode").Set("10001"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := user.Encode(v)
+	if !strings.Contains(string(data), `"zip_code":"10001"`) {
+		t.Errorf("unexpected json %s", data)
+	}
+
+	dump := models.Dump()
+	if strings.Contains(dump, "FirstName") || strings.Contains(dump, "ZipCode") || !strings.Contains(dump, "first_name") {
+		t.Errorf("dump should keep the names of the schema, %s", dump)
+	}
+
+	fields := []Field{{Name: "last_name", Type: "string"}}
+
+	if _, err = NewBuilder().(*Builder).WithNameNormalization().Build(fields, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if fields[0].Name != "last_name" || len(fields[0].Tags) > 0 {
+		t.Errorf("build should not change its input, %+v", fields[0])
+	}
+}
@@ -0,0 +1,103 @@
+package dmod
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// NullStrategy decides how the builder builds fields with Nullable
+type NullStrategy int
+
+const (
+	// NullPointer builds nullable fields as pointers, e.g. `*string`
+	NullPointer NullStrategy = iota
+	// NullSQL builds nullable fields as sql.Null types, e.g.
+	// sql.NullString, types without a sql.Null type are built as pointers,
+	// only Model.Encode and Model.Decode write them as plain json values
+	NullSQL
+)
+
+var (
+	sqlNullTypes = map[reflect.Type]reflect.Type{
+		reflect.TypeOf(""):          reflect.TypeOf(sql.NullString{}),
+		reflect.TypeOf(int(0)):      reflect.TypeOf(sql.NullInt64{}),
+		reflect.TypeOf(int64(0)):    reflect.TypeOf(sql.NullInt64{}),
+		reflect.TypeOf(int32(0)):    reflect.TypeOf(sql.NullInt32{}),
+		reflect.TypeOf(int16(0)):    reflect.TypeOf(sql.NullInt16{}),
+		reflect.TypeOf(byte(0)):     reflect.TypeOf(sql.NullByte{}),
+		reflect.TypeOf(float64(0)):  reflect.TypeOf(sql.NullFloat64{}),
+		reflect.TypeOf(false):       reflect.TypeOf(sql.NullBool{}),
+		reflect.TypeOf(time.Time{}): reflect.TypeOf(sql.NullTime{}),
+	}
+
+	sqlNullValueTypes = newSQLNullValueTypes()
+)
+
+func newSQLNullValueTypes() map[reflect.Type]bool {
+	types := map[reflect.Type]bool{}
+	for _, typ := range sqlNullTypes {
+		types[typ] = true
+	}
+	return types
+}
+
+func (p NullStrategy) String() string {
+	switch p {
+	case NullPointer:
+		return "pointer"
+	case NullSQL:
+		return "sql"
+	}
+	return "unknown"
+}
+
+// nullable reports whether the field is declared nullable or as a pointer
+func (p *Field) nullable() bool {
+	return p.Nullable || p.Pointer || strings.HasPrefix(strings.TrimSpace(p.Type), "*")
+}
+
+// nullableType makes typ nullable by the strategy of the builder, pointers,
+// slices, maps and interfaces are already nullable
+func (p *Builder) nullableType(typ reflect.Type) reflect.Type {
+
+	switch typ.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return typ
+	}
+
+	if sqlNullValueTypes[typ] {
+		return typ
+	}
+
+	if p.nullStrategy == NullSQL {
+		if nullType, exist := sqlNullTypes[typ]; exist {
+			return nullType
+		}
+	}
+
+	return reflect.PtrTo(typ)
+}
+
+// nullValue unwraps the value of a sql.Null type or a pointer, null is
+// true when it is not valid or nil
+func nullValue(value reflect.Value) (unwrapped reflect.Value, null bool) {
+
+	switch {
+	case !value.IsValid():
+		return value, true
+	case sqlNullValueTypes[value.Type()]:
+		if !value.FieldByName("Valid").Bool() {
+			return reflect.Value{}, true
+		}
+		return value.Field(0), false
+	case value.Kind() == reflect.Ptr:
+		if value.IsNil() {
+			return reflect.Value{}, true
+		}
+		return nullValue(value.Elem())
+	}
+
+	return value, false
+}
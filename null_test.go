@@ -0,0 +1,89 @@
+package dmod
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestNullSQL(t *testing.T) {
+	models, _ := NewModels(ModelsOptNullStrategy(NullSQL))
+
+	err := models.LoadModels([]string{`{"name":"post","fields":[{"name":"Title","type":"string","nullable":true},{"name":"Views","type":"int","nullable":true},{"name":"Name","type":"string"}]}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post, _ := models.GetModel("post")
+
+	v := post.New()
+	if err = post.Field(v, "Title").Set("y"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := post.Encode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != `{"Title":"y","Views":null,"Name":""}` {
+		t.Errorf("unexpected json %s", data)
+	}
+
+	decoded, err := post.Decode([]byte(`{"Title":null,"Views":3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	title := post.Field(decoded, "Title").Interface().(*sql.NullString)
+	views := post.Field(decoded, "Views").Interface().(*sql.NullInt64)
+	if title.Valid || !views.Valid || views.Int64 != 3 {
+		t.Errorf("unexpected decoded values %+v %+v", title, views)
+	}
+
+	var s string
+	var p *string
+	var n int
+
+	if err = post.Field(v, "Title").Value(&s); err != nil || s != "y" {
+		t.Errorf("value into string got %q, %v", s, err)
+	}
+
+	if err = post.Field(v, "Title").Value(&p); err != nil || p == nil || *p != "y" {
+		t.Errorf("value into pointer got %v, %v", p, err)
+	}
+
+	if err = post.Field(decoded, "Views").Value(&n); err != nil || n != 3 {
+		t.Errorf("value into int got %d, %v", n, err)
+	}
+
+	if err = post.Field(decoded, "Title").Value(&p); err != nil || p != nil {
+		t.Errorf("null value into pointer got %v, %v", p, err)
+	}
+}
+
+func TestBindCSVEmptyCells(t *testing.T) {
+	models, _ := NewModels(ModelsOptNullStrategy(NullSQL))
+
+	err := models.LoadModels([]string{`{"name":"post","fields":[{"name":"Title","type":"string","nullable":true},{"name":"Name","type":"string"}]}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post, _ := models.GetModel("post")
+
+	v := post.New()
+	post.Field(v, "Title").Set("y")
+	post.Field(v, "Name").Set("n")
+
+	if err = post.BindCSV(v, []string{"Title", "Name"}, []string{"", ""}); err != nil {
+		t.Fatal(err)
+	}
+
+	if title := post.Field(v, "Title").Interface().(*sql.NullString); title.Valid {
+		t.Errorf("empty cell should set null, got %+v", title)
+	}
+
+	if name := post.Field(v, "Name").Interface().(*string); *name != "n" {
+		t.Errorf("empty cell should keep other fields, got %q", *name)
+	}
+}
@@ -0,0 +1,79 @@
+package dmod
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRecursiveTree(t *testing.T) {
+	models, _ := NewModels()
+
+	err := models.LoadModels([]string{
+		`{"name":"category","fields":[{"name":"Name","type":"string"},{"name":"Parent","ref":"category","pointer":true},{"name":"Children","type":"[]*category"}]}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	category, _ := models.GetModel("category")
+
+	data := `{"Name":"leaf","Parent":{"Name":"mid","Parent":{"Name":"root","Parent":null,"Children":[]},"Children":[]},"Children":[{"Name":"a","Parent":null,"Children":[]}]}`
+
+	v, err := category.Decode([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var name string
+	if err = category.Field(v, ".Parent.Parent.Name").Value(&name); err != nil || name != "root" {
+		t.Errorf("deep path got %q, %v", name, err)
+	}
+
+	if err = category.Field(v, ".Parent.Parent.Name").Set("top"); err != nil {
+		t.Fatal(err)
+	}
+
+	name = ""
+	if err = category.Field(v, ".Parent.Parent.Parent.Name").Value(&name); err != nil || name != "" {
+		t.Errorf("path through a null ref got %q, %v", name, err)
+	}
+
+	encoded, err := category.Encode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"Name":"leaf","Parent":{"Name":"mid","Parent":{"Name":"top","Parent":null,"Children":[]},"Children":[]},"Children":[{"Name":"a","Parent":null,"Children":[]}]}`
+	if string(encoded) != want {
+		t.Errorf("encode got\n%s\nwant\n%s", encoded, want)
+	}
+
+	plain, err := json.Marshal(v)
+	if err != nil || string(plain) != want {
+		t.Errorf("json.Marshal got %s, %v", plain, err)
+	}
+}
+
+func TestMutualRecursion(t *testing.T) {
+	models, _ := NewModels()
+
+	err := models.LoadModels([]string{
+		`{"name":"employee","fields":[{"name":"Name","type":"string"},{"name":"Team","ref":"team","pointer":true}]}`,
+		`{"name":"team","fields":[{"name":"Title","type":"string"},{"name":"Lead","ref":"employee","pointer":true}]}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	employee, _ := models.GetModel("employee")
+
+	v, err := employee.Decode([]byte(`{"Name":"ann","Team":{"Title":"core","Lead":{"Name":"bob","Team":null}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var name string
+	if err = employee.Field(v, ".Team.Lead.Name").Value(&name); err != nil || name != "bob" {
+		t.Errorf("deep path got %q, %v", name, err)
+	}
+}
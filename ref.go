@@ -0,0 +1,316 @@
+package dmod
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	typeOfRef = reflect.TypeOf((*Ref)(nil)).Elem()
+)
+
+// Ref is the value of a recursive ref field, e.g. `category.Parent` with
+// the type `*category`, reflect.StructOf could not build recursive types,
+// so such fields are built as Ref and the value is typed by the target
+// model when the instance is created by Model.New
+type Ref struct {
+	model *Model
+	value reflect.Value
+}
+
+// Model returns the target model, nil if the ref is not bound
+func (p *Ref) Model() *Model {
+	return p.model
+}
+
+// Interface returns the value, e.g. `*category`, `[]*category` or
+// `map[string]*category`
+func (p *Ref) Interface() interface{} {
+	if !p.value.IsValid() {
+		return nil
+	}
+
+	return p.value.Interface()
+}
+
+// Set sets the value, nil resets it to the zero value
+func (p *Ref) Set(value interface{}) (err error) {
+	if !p.value.IsValid() {
+		err = errors.New("ref is not bound")
+		return
+	}
+
+	reflectValue, ok := value.(reflect.Value)
+	if !ok {
+		reflectValue = reflect.ValueOf(value)
+	}
+
+	if !reflectValue.IsValid() {
+		p.value.Set(reflect.Zero(p.value.Type()))
+		return
+	}
+
+	if !reflectValue.Type().ConvertibleTo(p.value.Type()) {
+		err = fmt.Errorf("could not convert argument of ref %s from %s to %s", p.model.Name(), reflectValue.Type(), p.value.Type())
+		return
+	}
+
+	p.value.Set(reflectValue.Convert(p.value.Type()))
+
+	return
+}
+
+func (p Ref) MarshalJSON() ([]byte, error) {
+	if !p.value.IsValid() {
+		return []byte("null"), nil
+	}
+
+	if p.model == nil {
+		return json.Marshal(p.value.Interface())
+	}
+
+	return p.model.encodeJSON(p.value)
+}
+
+// UnmarshalJSON creates the instances of the target model by Model.New,
+// so refs nested in them are bound before they are decoded
+func (p *Ref) UnmarshalJSON(data []byte) (err error) {
+	if p.model == nil {
+		err = errors.New("ref is not bound")
+		return
+	}
+
+	value, err := p.model.decodeRef(p.value.Type(), data)
+	if err != nil {
+		return
+	}
+
+	p.value.Set(value)
+
+	return
+}
+
+// bind types the value by typ, a value copied from another instance is
+// copied again so instances never share it
+func (p *Ref) bind(model *Model, typ reflect.Type) {
+	value := reflect.New(typ).Elem()
+
+	switch {
+	case p.value.IsValid() && p.value.Type() == typ:
+		value.Set(p.value)
+	case typ.Kind() == reflect.Slice:
+		value.Set(reflect.MakeSlice(typ, 0, 0))
+	case typ.Kind() == reflect.Map:
+		value.Set(reflect.MakeMap(typ))
+	}
+
+	p.model = model
+	p.value = value
+}
+
+// refBinding is a recursive ref field of a model at index
+type refBinding struct {
+	index  []int
+	target string
+	field  Field
+	expr   *typeExpr
+}
+
+// valueType composes the type of the ref value over the target model,
+// e.g. `[]*category`
+func (p refBinding) valueType(target *Model) (typ reflect.Type, err error) {
+	typ = target.Type()
+
+	if p.expr != nil {
+		typ, err = typeOf(p.expr, typ, func(name string) (reflect.Type, bool) {
+			t, exist := typeMap[name]
+			return t, exist
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	return shapeType(p.field, typ)
+}
+
+// collectRefBindings finds the recursive refs of fields in the struct typ,
+// they could only be nested in plain struct fields, slices and maps of
+// structs are created by encoding/json which could not bind them
+func collectRefBindings(fields []Field, typ reflect.Type, index []int) (refs []refBinding, err error) {
+
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+
+		sField, exist := typ.FieldByName(field.Name)
+		if !exist {
+			continue
+		}
+
+		fieldIndex := append(append([]int{}, index...), sField.Index...)
+
+		if len(field.lateRef) > 0 {
+			binding := refBinding{index: fieldIndex, target: field.lateRef, field: field}
+
+			if len(field.Type) > 0 {
+				binding.expr, err = parseTypeExpr(field.Type)
+				if err != nil {
+					return
+				}
+			}
+
+			refs = append(refs, binding)
+			continue
+		}
+
+		if !hasLateRefs(field.Children) {
+			continue
+		}
+
+		if sField.Type.Kind() != reflect.Struct {
+			err = fmt.Errorf("field %s holds recursive refs, it could only be a struct, declare it as a model to make it nullable", field.Name)
+			return
+		}
+
+		var nested []refBinding
+		nested, err = collectRefBindings(field.Children, sField.Type, fieldIndex)
+		if err != nil {
+			return
+		}
+
+		refs = append(refs, nested...)
+	}
+
+	return
+}
+
+func hasLateRefs(fields []Field) bool {
+	for i := 0; i < len(fields); i++ {
+		if len(fields[i].lateRef) > 0 || hasLateRefs(fields[i].Children) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bindRefs binds the recursive refs of the instance st to the models of
+// the same generation
+func (p *Model) bindRefs(st reflect.Value) {
+
+	for _, binding := range p.refs {
+		target, exist := p.registry[binding.target]
+		if !exist {
+			continue
+		}
+
+		typ, err := binding.valueType(target)
+		if err != nil {
+			continue
+		}
+
+		ref := st.Elem().FieldByIndex(binding.index).Addr().Interface().(*Ref)
+		ref.bind(target, typ)
+	}
+}
+
+// decodeRef decodes data into a value of typ, instances of the model are
+// created by New, typ is composed of pointers, slices, arrays and maps
+// over the model
+func (p *Model) decodeRef(typ reflect.Type, data []byte) (value reflect.Value, err error) {
+
+	null := bytes.Equal(bytes.TrimSpace(data), []byte("null"))
+
+	switch {
+	case typ == p.Type():
+		instance := p.New()
+		if !null {
+			err = p.decodeJSON(data, reflect.ValueOf(instance))
+			if err == nil {
+				err = p.Validate(instance)
+			}
+		}
+		value = reflect.ValueOf(instance).Elem()
+		return
+	case null && (typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map):
+		value = reflect.Zero(typ)
+		return
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		var elem reflect.Value
+		elem, err = p.decodeRef(typ.Elem(), data)
+		if err != nil {
+			return
+		}
+
+		if elem.CanAddr() {
+			value = elem.Addr()
+			return
+		}
+
+		value = reflect.New(typ.Elem())
+		value.Elem().Set(elem)
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if err = json.Unmarshal(data, &items); err != nil {
+			return
+		}
+
+		if typ.Kind() == reflect.Slice {
+			value = reflect.MakeSlice(typ, len(items), len(items))
+		} else {
+			value = reflect.New(typ).Elem()
+		}
+
+		for i := 0; i < len(items) && i < value.Len(); i++ {
+			var item reflect.Value
+			item, err = p.decodeRef(typ.Elem(), items[i])
+			if err != nil {
+				return
+			}
+			value.Index(i).Set(item)
+		}
+	case reflect.Map:
+		if typ.Key().Kind() != reflect.String {
+			err = fmt.Errorf("could not decode ref map with key %s", typ.Key())
+			return
+		}
+
+		var items map[string]json.RawMessage
+		if err = json.Unmarshal(data, &items); err != nil {
+			return
+		}
+
+		value = reflect.MakeMapWithSize(typ, len(items))
+
+		for k, v := range items {
+			var item reflect.Value
+			item, err = p.decodeRef(typ.Elem(), v)
+			if err != nil {
+				return
+			}
+			value.SetMapIndex(reflect.ValueOf(k).Convert(typ.Key()), item)
+		}
+	default:
+		ptr := reflect.New(typ)
+		err = json.Unmarshal(data, ptr.Interface())
+		value = ptr.Elem()
+	}
+
+	return
+}
+
+// newRefElem allocates an element of typ for ModelField, instances of the
+// target model of ref are created by New so their refs are bound
+func newRefElem(ref *Ref, typ reflect.Type) reflect.Value {
+	if ref != nil && ref.model != nil && typ == ref.model.Type() {
+		return reflect.ValueOf(ref.model.New())
+	}
+
+	return reflect.New(typ)
+}
@@ -0,0 +1,288 @@
+package dmod
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var (
+	typeOfTime            = reflect.TypeOf(time.Time{})
+	typeOfDuration        = reflect.TypeOf(time.Duration(0))
+	typeOfTextUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Scalar is a custom scalar type registered by name, e.g. `email`, Parse
+// reads it from strings of forms, csv and json, Format writes it to json,
+// Validate checks every value set to a field, each of them is optional
+type Scalar struct {
+	Name     string
+	Type     interface{}
+	Parse    func(s string) (interface{}, error)
+	Format   func(v interface{}) (string, error)
+	Validate func(v interface{}) error
+
+	typ reflect.Type
+}
+
+// ReflectType returns the type of the fields
+func (p *Scalar) ReflectType() reflect.Type {
+	return p.typ
+}
+
+// parse reads s into a value of the type, the result of Parse is
+// converted and validated
+func (p *Scalar) parse(s string) (value reflect.Value, err error) {
+
+	if p.Parse == nil {
+		value, err = parseString(p.typ, s)
+	} else {
+		var v interface{}
+		v, err = p.Parse(s)
+		if err != nil {
+			return
+		}
+
+		value = reflect.ValueOf(v)
+		if !value.IsValid() || !value.Type().ConvertibleTo(p.typ) {
+			err = fmt.Errorf("scalar %s parsed %q to %T", p.Name, s, v)
+			return
+		}
+
+		value = value.Convert(p.typ)
+	}
+
+	if err != nil {
+		err = fmt.Errorf("parse scalar %s failed, %w", p.Name, err)
+		return
+	}
+
+	err = p.validate(value)
+
+	return
+}
+
+func (p *Scalar) format(value reflect.Value) (string, error) {
+	if p.Format == nil {
+		return fmt.Sprint(value.Interface()), nil
+	}
+
+	return p.Format(value.Interface())
+}
+
+func (p *Scalar) validate(value reflect.Value) (err error) {
+	if p.Validate == nil {
+		return
+	}
+
+	if err = p.Validate(value.Interface()); err != nil {
+		err = fmt.Errorf("invalid %s, %w", p.Name, err)
+	}
+
+	return
+}
+
+// validateValue validates value, or every element of a pointer, slice,
+// array or map value, nil pointers and zero values are unset
+func (p *Scalar) validateValue(value reflect.Value) (err error) {
+
+	if !value.IsValid() {
+		return
+	}
+
+	if value.Type() == p.typ {
+		if value.IsZero() {
+			return
+		}
+		return p.validate(value)
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !value.IsNil() {
+			err = p.validateValue(value.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len() && err == nil; i++ {
+			err = p.validateValue(value.Index(i))
+		}
+	case reflect.Map:
+		iter := value.MapRange()
+		for iter.Next() && err == nil {
+			err = p.validateValue(iter.Value())
+		}
+	}
+
+	return
+}
+
+// coerce parses the strings of value into typ which is composed of
+// pointers, slices and maps over the type, e.g. `[]string` into `[]email`,
+// other values are returned as they are
+func (p *Scalar) coerce(value reflect.Value, typ reflect.Type) (reflect.Value, error) {
+
+	if !value.IsValid() || value.Type() == typ {
+		return value, nil
+	}
+
+	if value.Kind() == reflect.String && typ == p.typ {
+		return p.parse(value.String())
+	}
+
+	switch {
+	case typ.Kind() == reflect.Ptr && value.Kind() != reflect.Ptr:
+		elem, err := p.coerce(value, typ.Elem())
+		if err != nil || elem.Type() != typ.Elem() {
+			return value, err
+		}
+
+		ptr := reflect.New(typ.Elem())
+		ptr.Elem().Set(elem)
+		return ptr, nil
+	case typ.Kind() == reflect.Slice && value.Kind() == reflect.Slice:
+		items := reflect.MakeSlice(typ, value.Len(), value.Len())
+		for i := 0; i < value.Len(); i++ {
+			item, err := p.coerce(value.Index(i), typ.Elem())
+			if err != nil {
+				return value, err
+			}
+			if !item.Type().ConvertibleTo(typ.Elem()) {
+				return value, nil
+			}
+			items.Index(i).Set(item.Convert(typ.Elem()))
+		}
+		return items, nil
+	case typ.Kind() == reflect.Map && value.Kind() == reflect.Map && value.Type().Key().ConvertibleTo(typ.Key()):
+		items := reflect.MakeMapWithSize(typ, value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			item, err := p.coerce(iter.Value(), typ.Elem())
+			if err != nil {
+				return value, err
+			}
+			if !item.Type().ConvertibleTo(typ.Elem()) {
+				return value, nil
+			}
+			items.SetMapIndex(iter.Key().Convert(typ.Key()), item.Convert(typ.Elem()))
+		}
+		return items, nil
+	}
+
+	return value, nil
+}
+
+// RegisterScalars registers the scalars as types, so they could be used
+// by name in Field.Type, e.g. `email` or `[]email`
+func (p *Builder) RegisterScalars(scalars ...Scalar) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.scalars == nil {
+		p.scalars = make(map[string]*Scalar)
+	}
+
+	for i := 0; i < len(scalars); i++ {
+		scalar := scalars[i]
+
+		scalar.typ = reflect.TypeOf(scalar.Type)
+		if scalar.typ.Kind() == reflect.Ptr {
+			scalar.typ = scalar.typ.Elem()
+		}
+
+		p.registeredTypes[scalar.Name] = scalar.typ
+		p.scalars[scalar.Name] = &scalar
+	}
+}
+
+func (p *Builder) lookupScalar(name string) (scalar *Scalar, exist bool) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	scalar, exist = p.scalars[name]
+	return
+}
+
+// annotateScalars sets the scalar of every field typed by a registered
+// scalar, children of refs are annotated too because they are shared
+func annotateScalars(fields []Field, builder StructBuilder) {
+
+	b, ok := builder.(*Builder)
+	if !ok {
+		return
+	}
+
+	for i := 0; i < len(fields); i++ {
+		field := &fields[i]
+
+		field.scalar = nil
+
+		if len(field.Type) > 0 && field.enum == nil && len(field.lateRef) == 0 {
+			if expr, err := parseTypeExpr(field.Type); err == nil {
+				field.scalar, _ = b.lookupScalar(expr.baseName())
+			}
+		}
+
+		annotateScalars(field.Children, builder)
+	}
+}
+
+// parseString parses s into a value of typ, pointers are allocated,
+// builtin kinds, time.Time in RFC3339, time.Duration and
+// encoding.TextUnmarshaler are supported
+func parseString(typ reflect.Type, s string) (value reflect.Value, err error) {
+
+	value = reflect.New(typ).Elem()
+
+	if reflect.PtrTo(typ).Implements(typeOfTextUnmarshaler) {
+		err = value.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+		return
+	}
+
+	switch {
+	case typ == typeOfTime:
+		var t time.Time
+		t, err = time.Parse(time.RFC3339, s)
+		value.Set(reflect.ValueOf(t))
+		return
+	case typ == typeOfDuration:
+		var d time.Duration
+		d, err = time.ParseDuration(s)
+		value.SetInt(int64(d))
+		return
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		var elem reflect.Value
+		elem, err = parseString(typ.Elem(), s)
+		if err != nil {
+			return
+		}
+		value.Set(reflect.New(typ.Elem()))
+		value.Elem().Set(elem)
+	case reflect.String:
+		value.SetString(s)
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(s)
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		i, err = strconv.ParseInt(s, 10, typ.Bits())
+		value.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		u, err = strconv.ParseUint(s, 10, typ.Bits())
+		value.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		f, err = strconv.ParseFloat(s, typ.Bits())
+		value.SetFloat(f)
+	default:
+		err = fmt.Errorf("could not parse %s from string", typ)
+	}
+
+	return
+}
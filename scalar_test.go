@@ -0,0 +1,89 @@
+package dmod
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type testEmail string
+
+func TestScalar(t *testing.T) {
+	models, _ := NewModels()
+
+	err := models.RegisterScalars(Scalar{
+		Name:   "email",
+		Type:   (*testEmail)(nil),
+		Parse:  func(s string) (interface{}, error) { return testEmail(strings.ToLower(s)), nil },
+		Format: func(v interface{}) (string, error) { return "mailto:" + string(v.(testEmail)), nil },
+		Validate: func(v interface{}) error {
+			if !strings.Contains(string(v.(testEmail)), "@") {
+				return errors.New("missing @")
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.LoadModels([]string{
+		`{"name":"user","fields":[{"name":"Email","type":"email"},{"name":"Others","type":"[]email"}]}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, _ := models.GetModel("user")
+	v := user.New()
+
+	if err = user.Field(v, "Email").Set("Ann@Example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	var email testEmail
+	if err = user.Field(v, "Email").Value(&email); err != nil || email != "ann@example.com" {
+		t.Errorf("set got %q, %v", email, err)
+	}
+
+	if err = user.Field(v, "Email").Set("nobody"); err == nil || !strings.Contains(err.Error(), "missing @") {
+		t.Errorf("invalid set got %v", err)
+	}
+
+	if err = user.Field(v, "Email").Set(testEmail("nobody")); err == nil {
+		t.Error("invalid typed value should fail")
+	}
+
+	err = user.BindForm(v, url.Values{"Email": {"Bob@Example.com"}, "Others": {"A@x.io", "B@y.io"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := user.Encode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"Email":"mailto:bob@example.com","Others":["mailto:a@x.io","mailto:b@y.io"]}`
+	if string(data) != want {
+		t.Errorf("encode got %s, want %s", data, want)
+	}
+
+	if err = user.BindForm(v, url.Values{"Others": {"a@x.io", "broken"}}); err == nil {
+		t.Error("invalid form value should fail")
+	}
+
+	if _, err = user.Decode([]byte(`{"Email":"broken"}`)); err == nil {
+		t.Error("invalid json value should fail")
+	}
+
+	decoded, err := user.Decode([]byte(`{"Email":"Eve@Example.com"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = user.Field(decoded, "Email").Value(&email); err != nil || email != "eve@example.com" {
+		t.Errorf("decode got %q, %v", email, err)
+	}
+}
@@ -0,0 +1,142 @@
+package dmod
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Snapshot is one immutable generation of the models registry, it never
+// changes after it was published, so a request could pin a snapshot and
+// see a consistent set of models while loads publish newer generations
+type Snapshot struct {
+	generation uint64
+
+	modelsInstance map[string]*Model
+	modelsConfig   map[string]*ModelConfig
+	enums          map[string]*Enum
+}
+
+func newSnapshot(generation uint64, instances map[string]*Model, configs map[string]*ModelConfig, enums map[string]*Enum) *Snapshot {
+	return &Snapshot{
+		generation:     generation,
+		modelsInstance: instances,
+		modelsConfig:   configs,
+		enums:          enums,
+	}
+}
+
+func (p *Snapshot) Generation() uint64 {
+	return p.generation
+}
+
+func (p *Snapshot) GetModel(name string) (*Model, bool) {
+	m, e := p.modelsInstance[name]
+	return m, e
+}
+
+// Models returns the models sorted by name, internal models are hidden
+func (p *Snapshot) Models() []*Model {
+	var names []string
+	for name, model := range p.modelsInstance {
+		if !model.Internal() {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	var models []*Model
+
+	for _, name := range names {
+		models = append(models, p.modelsInstance[name])
+	}
+
+	return models
+}
+
+func (p *Snapshot) GetEnum(name string) (*Enum, bool) {
+	e, exist := p.enums[name]
+	return e, exist
+}
+
+func (p *Snapshot) Enums() []*Enum {
+	return sortedEnums(p.enums)
+}
+
+// Dump dumps every model except internal ones
+func (p *Snapshot) Dump() string {
+
+	allModels := map[string]dumpedModel{}
+
+	for k, v := range p.modelsInstance {
+		if !v.Internal() {
+			allModels[k] = v.dumped()
+		}
+	}
+
+	dumpData, _ := json.MarshalIndent(allModels, "", "    ")
+	return string(dumpData)
+}
+
+func (p *Snapshot) Produce(model *Model, values ...interface{}) interface{} {
+	if model == nil {
+		return nil
+	}
+
+	return p.ProduceByName(model.name, values...)
+}
+
+func (p *Snapshot) ProduceByName(name string, values ...interface{}) interface{} {
+	if len(name) == 0 {
+		return nil
+	}
+
+	model, exist := p.GetModel(name)
+	if !exist {
+		return nil
+	}
+
+	if model.Abstract() {
+		logrus.WithField("model", name).Warnln("abstract model could not be produced")
+		return nil
+	}
+
+	return model.New(values...)
+}
+
+// copyModelsConfig returns the original definitions of every model,
+// they could be resolved again without touching the snapshot
+func (p *Snapshot) copyModelsConfig() map[string]*ModelConfig {
+	allModels := map[string]*ModelConfig{}
+
+	for k, v := range p.modelsConfig {
+		copyModel := v.clone()
+		allModels[k] = &copyModel
+	}
+
+	return allModels
+}
+
+// copyEnumsConfig returns the configs of every enum
+func (p *Snapshot) copyEnumsConfig() map[string]*EnumConfig {
+	allEnums := map[string]*EnumConfig{}
+
+	for k, v := range p.enums {
+		config := v.config
+		allEnums[k] = &config
+	}
+
+	return allEnums
+}
+
+func (p *Snapshot) copyModelsInstance() map[string]*Model {
+	instances := make(map[string]*Model, len(p.modelsInstance))
+
+	for k, v := range p.modelsInstance {
+		instances[k] = v
+	}
+
+	return instances
+}
@@ -1,6 +1,7 @@
 package dmod
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"strings"
@@ -13,70 +14,101 @@ var (
 )
 
 var (
-	typeMap = map[string]reflect.Type{
-		"string":      reflect.TypeOf((*string)(nil)).Elem(),
-		"int":         reflect.TypeOf((*int)(nil)).Elem(),
-		"int8":        reflect.TypeOf((*int8)(nil)).Elem(),
-		"int32":       reflect.TypeOf((*int32)(nil)).Elem(),
-		"int64":       reflect.TypeOf((*int64)(nil)).Elem(),
-		"uint":        reflect.TypeOf((*uint)(nil)).Elem(),
-		"uint8":       reflect.TypeOf((*uint8)(nil)).Elem(),
-		"uint32":      reflect.TypeOf((*uint32)(nil)).Elem(),
-		"uint64":      reflect.TypeOf((*uint64)(nil)).Elem(),
-		"float32":     reflect.TypeOf((*float32)(nil)).Elem(),
-		"float64":     reflect.TypeOf((*float64)(nil)).Elem(),
-		"bool":        reflect.TypeOf((*bool)(nil)).Elem(),
-		"byte":        reflect.TypeOf((*byte)(nil)).Elem(),
-		"error":       reflect.TypeOf((*error)(nil)).Elem(),
-		"struct":      reflect.TypeOf((*struct{})(nil)).Elem(),
-		"time.Time":   reflect.TypeOf((*time.Time)(nil)).Elem(),
-		"interface{}": reflect.TypeOf((*interface{})(nil)).Elem(),
-
-		"*string":      reflect.TypeOf((*string)(nil)),
-		"*int":         reflect.TypeOf((*int)(nil)),
-		"*int8":        reflect.TypeOf((*int8)(nil)),
-		"*int32":       reflect.TypeOf((*int32)(nil)),
-		"*int64":       reflect.TypeOf((*int64)(nil)),
-		"*uint":        reflect.TypeOf((*uint)(nil)),
-		"*uint8":       reflect.TypeOf((*uint8)(nil)),
-		"*uint32":      reflect.TypeOf((*uint32)(nil)),
-		"*uint64":      reflect.TypeOf((*uint64)(nil)),
-		"*float32":     reflect.TypeOf((*float32)(nil)),
-		"*float64":     reflect.TypeOf((*float64)(nil)),
-		"*bool":        reflect.TypeOf((*bool)(nil)),
-		"*byte":        reflect.TypeOf((*byte)(nil)),
-		"*error":       reflect.TypeOf((*error)(nil)),
-		"*struct":      reflect.TypeOf((*struct{})(nil)),
-		"*time.Time":   reflect.TypeOf((*time.Time)(nil)),
-		"*interface{}": reflect.TypeOf((*interface{})(nil)),
-
-		"map[string]string":      reflect.TypeOf((*[]map[string]string)(nil)).Elem(),
-		"map[string]interface{}": reflect.TypeOf((*[]map[string]interface{})(nil)).Elem(),
+	// builtinTypes is the only list of builtin type names, pointer, slice,
+	// array and map forms of them are composed by the type expression parser
+	builtinTypes = []NameType{
+		{"bool", (*bool)(nil)},
+		{"string", (*string)(nil)},
+		{"int", (*int)(nil)},
+		{"int8", (*int8)(nil)},
+		{"int16", (*int16)(nil)},
+		{"int32", (*int32)(nil)},
+		{"int64", (*int64)(nil)},
+		{"uint", (*uint)(nil)},
+		{"uint8", (*uint8)(nil)},
+		{"uint16", (*uint16)(nil)},
+		{"uint32", (*uint32)(nil)},
+		{"uint64", (*uint64)(nil)},
+		{"uintptr", (*uintptr)(nil)},
+		{"byte", (*byte)(nil)},
+		{"rune", (*rune)(nil)},
+		{"float32", (*float32)(nil)},
+		{"float64", (*float64)(nil)},
+		{"complex64", (*complex64)(nil)},
+		{"complex128", (*complex128)(nil)},
+		{"error", (*error)(nil)},
+		{"interface{}", (*interface{})(nil)},
+		{"any", (*interface{})(nil)},
+		{"struct", (*struct{})(nil)},
+		{"struct{}", (*struct{})(nil)},
+		{"time.Time", (*time.Time)(nil)},
+		{"time.Duration", (*time.Duration)(nil)},
+		{"json.RawMessage", (*json.RawMessage)(nil)},
+		{"decimal", (*Decimal)(nil)},
 	}
+
+	typeMap = newTypeMap(builtinTypes)
 )
 
+func newTypeMap(nameTypes []NameType) map[string]reflect.Type {
+	types := make(map[string]reflect.Type, len(nameTypes))
+
+	for i := 0; i < len(nameTypes); i++ {
+		types[nameTypes[i].Name] = reflect.TypeOf(nameTypes[i].Type).Elem()
+	}
+
+	return types
+}
+
 type StructBuilder interface {
 	Build(fields []Field, combineMap map[string]interface{}) (structFields []reflect.StructField, err error)
 	RegisterTypes(nameTypes ...NameType)
 }
 
 type Field struct {
-	Children  []Field `json:"children,omitempty"`
-	Name      string  `json:"name"`
-	Type      string  `json:"type,omitempty"`
-	Array     bool    `json:"array,omitempty"`
-	Tag       string  `json:"tag,omitempty"`
-	Anonymous bool    `json:"anonymous,omitempty"`
-	Ref       string  `json:"ref,omitempty"`
-
-	refUpdated       bool
-	originalChildren []Field
-	filepath         string
+	Children  []Field           `json:"children,omitempty" yaml:"children,omitempty" toml:"children,omitempty"`
+	Name      string            `json:"name" yaml:"name" toml:"name"`
+	Type      string            `json:"type,omitempty" yaml:"type,omitempty" toml:"type,omitempty"`
+	Array     bool              `json:"array,omitempty" yaml:"array,omitempty" toml:"array,omitempty"`
+	Pointer   bool              `json:"pointer,omitempty" yaml:"pointer,omitempty" toml:"pointer,omitempty"`
+	Map       bool              `json:"map,omitempty" yaml:"map,omitempty" toml:"map,omitempty"`
+	Tag       string            `json:"tag,omitempty" yaml:"tag,omitempty" toml:"tag,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty" yaml:"tags,omitempty" toml:"tags,omitempty"`
+	Anonymous bool              `json:"anonymous,omitempty" yaml:"anonymous,omitempty" toml:"anonymous,omitempty"`
+	Ref       string            `json:"ref,omitempty" yaml:"ref,omitempty" toml:"ref,omitempty"`
+	Nullable  bool              `json:"nullable,omitempty" yaml:"nullable,omitempty" toml:"nullable,omitempty"`
+	Precision int               `json:"precision,omitempty" yaml:"precision,omitempty" toml:"precision,omitempty"`
+	Scale     int               `json:"scale,omitempty" yaml:"scale,omitempty" toml:"scale,omitempty"`
+	Override  bool              `json:"override,omitempty" yaml:"override,omitempty" toml:"override,omitempty"`
+
+	OneOf         []string `json:"oneOf,omitempty" yaml:"oneOf,omitempty" toml:"oneOf,omitempty"`
+	Discriminator string   `json:"discriminator,omitempty" yaml:"discriminator,omitempty" toml:"discriminator,omitempty"`
+
+	refUpdated bool
+	filepath   string
+
+	// lateRef is the target of a recursive ref, the field is built as Ref
+	lateRef string
+
+	// embed is the parent model embedded by the field
+	embed string
+
+	// enum is set when the base name of Type is an enum
+	enum *Enum
+
+	// scalar is set when the base name of Type is a registered scalar
+	scalar *Scalar
 }
 
-func (p *Field) reset() {
-	p.refUpdated = false
-	p.Children = p.originalChildren
+// Enum returns the enum the field is typed by, nil for other fields
+func (p *Field) Enum() *Enum {
+	return p.enum
+}
+
+// Scalar returns the registered scalar the field is typed by, nil for
+// other fields
+func (p *Field) Scalar() *Scalar {
+	return p.scalar
 }
 
 type NameType struct {
@@ -86,6 +118,10 @@ type NameType struct {
 
 type Builder struct {
 	registeredTypes map[string]reflect.Type
+	scalars         map[string]*Scalar
+	tagPolicies     []TagPolicy
+	nullStrategy    NullStrategy
+	normalizeNames  bool
 
 	locker sync.Mutex
 }
@@ -110,32 +146,106 @@ func (p *Builder) RegisterTypes(nameTypes ...NameType) {
 	}
 }
 
+// WithTagPolicies returns a new builder with the tag policies appended
+func (p *Builder) WithTagPolicies(policies ...TagPolicy) StructBuilder {
+	builder := p.clone()
+
+	builder.tagPolicies = append(builder.tagPolicies, policies...)
+
+	return builder
+}
+
+// WithNullStrategy returns a new builder building nullable fields by strategy
+func (p *Builder) WithNullStrategy(strategy NullStrategy) StructBuilder {
+	builder := p.clone()
+
+	builder.nullStrategy = strategy
+
+	return builder
+}
+
+// WithNameNormalization returns a new builder normalizing field names which
+// are not exported go identifiers, e.g. `first_name` to `FirstName`
+func (p *Builder) WithNameNormalization() StructBuilder {
+	builder := p.clone()
+
+	builder.normalizeNames = true
+
+	return builder
+}
+
+// normalizeFields returns fields as they are named in the built structs
+func (p *Builder) normalizeFields(fields []Field) []Field {
+	if !p.normalizeNames {
+		return fields
+	}
+	return normalizeFieldNames(fields)
+}
+
+// clone copies p for the With options, p is never changed because the default builder is shared
+func (p *Builder) clone() *Builder {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	builder := &Builder{
+		registeredTypes: make(map[string]reflect.Type, len(p.registeredTypes)),
+		scalars:         make(map[string]*Scalar, len(p.scalars)),
+		nullStrategy:    p.nullStrategy,
+		normalizeNames:  p.normalizeNames,
+	}
+
+	for k, v := range p.registeredTypes {
+		builder.registeredTypes[k] = v
+	}
+
+	for k, v := range p.scalars {
+		builder.scalars[k] = v
+	}
+
+	builder.tagPolicies = append(builder.tagPolicies, p.tagPolicies...)
+
+	return builder
+}
+
+// fieldTag renders the tag of field with the tag policies applied
+func (p *Builder) fieldTag(field Field, typ reflect.Type) reflect.StructTag {
+	if len(p.tagPolicies) == 0 || field.Anonymous {
+		return field.StructTag()
+	}
+
+	values := field.tagValues()
+
+	for _, policy := range p.tagPolicies {
+		if _, exist := values[policy.Key]; exist {
+			continue
+		}
+
+		values[policy.Key] = policy.value(field, typ)
+	}
+
+	return renderStructTag(values)
+}
+
+// Build builds the struct fields of fields, the names of fields are checked
+// first, fields is not changed when names are normalized
 func (p *Builder) Build(fields []Field, combineMap map[string]interface{}) (structFields []reflect.StructField, err error) {
 
+	fields = p.normalizeFields(fields)
+
+	if err = checkFieldNames(fields, ""); err != nil {
+		return
+	}
+
 	var sFields []reflect.StructField
 
 	for i := 0; i < len(fields); i++ {
-		var typ reflect.Type
-		typ, err = p.buildStructFields("."+fields[i].Name, fields[i], combineMap)
+		var sField reflect.StructField
+		sField, err = p.buildStructField("."+fields[i].Name, fields[i], combineMap)
 		if err != nil {
 			return
 		}
 
-		if fields[i].Array {
-
-			// typ = reflect.SliceOf(reflect.PtrTo(typ))
-			// fmt.Println(typ)
-
-			typ = reflect.SliceOf(typ)
-		}
-
-		sFields = append(sFields,
-			reflect.StructField{
-				Name:      fields[i].Name,
-				Type:      typ,
-				Tag:       reflect.StructTag(fields[i].Tag),
-				Anonymous: fields[i].Anonymous,
-			})
+		sFields = append(sFields, sField)
 	}
 
 	base, existCombine := combineMap["."]
@@ -155,39 +265,83 @@ func (p *Builder) Build(fields []Field, combineMap map[string]interface{}) (stru
 	return
 }
 
-func (p *Builder) buildStructFields(name string, field Field, combineMap map[string]interface{}) (retType reflect.Type, err error) {
+// buildStructField builds the struct field of field at path name
+func (p *Builder) buildStructField(name string, field Field, combineMap map[string]interface{}) (sField reflect.StructField, err error) {
 
-	if len(field.Children) == 0 {
-		typ, exist := p.registeredTypes[field.Type]
+	typ := typeOfRef
 
-		if !exist {
-			typ, exist = typeMap[field.Type]
+	if len(field.OneOf) > 0 {
+		if len(field.Type) > 0 || len(field.Ref) > 0 || len(field.Children) > 0 {
+			err = fmt.Errorf("union field %s could not have type, ref or children", field.Name)
+			return
 		}
 
-		if !exist {
-			err = fmt.Errorf("type %s not register", field.Type)
+		typ, err = shapeType(field, typeOfOneOf)
+	} else if len(field.lateRef) > 0 {
+		_, err = shapeType(field, typ)
+	} else {
+		typ, err = p.buildStructFields(name, field, combineMap)
+		if err != nil {
 			return
 		}
 
-		retType = typ
+		typ, err = shapeType(field, typ)
+	}
+
+	if err != nil {
+		return
+	}
+
+	if field.Nullable && len(field.lateRef) == 0 && len(field.OneOf) == 0 {
+		typ = p.nullableType(typ)
+	}
+
+	sField = reflect.StructField{
+		Name:      field.Name,
+		Type:      typ,
+		Tag:       p.fieldTag(field, typ),
+		Anonymous: field.Anonymous,
+	}
+
+	return
+}
+
+// shapeType applies the Pointer, Array and Map flags of field to typ
+func shapeType(field Field, typ reflect.Type) (reflect.Type, error) {
+
+	if field.Array && field.Map {
+		return nil, fmt.Errorf("field %s could not be both array and map", field.Name)
+	}
+
+	if field.Pointer {
+		typ = reflect.PtrTo(typ)
+	}
+
+	if field.Array {
+		typ = reflect.SliceOf(typ)
+	} else if field.Map {
+		typ = reflect.MapOf(typeMap["string"], typ)
+	}
+
+	return typ, nil
+}
+
+func (p *Builder) buildStructFields(name string, field Field, combineMap map[string]interface{}) (retType reflect.Type, err error) {
+
+	if len(field.Children) == 0 {
+		retType, err = p.fieldType(field, nil)
 		return
 	}
 
 	var childFields []reflect.StructField
 	for i := 0; i < len(field.Children); i++ {
-		var typ reflect.Type
-		typ, err = p.buildStructFields(name+"."+field.Name, field.Children[i], combineMap)
+		var sField reflect.StructField
+		sField, err = p.buildStructField(name+"."+field.Children[i].Name, field.Children[i], combineMap)
 		if err != nil {
 			return
 		}
 
-		childFields = append(childFields,
-			reflect.StructField{
-				Name:      field.Children[i].Name,
-				Type:      typ,
-				Tag:       reflect.StructTag(field.Children[i].Tag),
-				Anonymous: field.Children[i].Anonymous,
-			})
+		childFields = append(childFields, sField)
 	}
 
 	base, existCombine := combineMap[name]
@@ -199,7 +353,71 @@ func (p *Builder) buildStructFields(name string, field Field, combineMap map[str
 		}, childFields...)
 	}
 
-	retType = reflect.StructOf(childFields)
+	structType, err := structOf(childFields)
+	if err != nil {
+		return
+	}
+
+	retType, err = p.fieldType(field, structType)
+
+	return
+}
+
+// structOf calls reflect.StructOf, its panic is returned as an error
+func structOf(fields []reflect.StructField) (typ reflect.Type, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("build struct failed, %v", r)
+		}
+	}()
+
+	typ = reflect.StructOf(fields)
+
+	return
+}
+
+// fieldType parses the type of field with the struct of its children as base
+func (p *Builder) fieldType(field Field, structType reflect.Type) (typ reflect.Type, err error) {
+
+	if len(field.Type) == 0 {
+		if structType == nil {
+			err = fmt.Errorf("type of field %s is empty", field.Name)
+			return
+		}
+
+		typ = structType
+		return
+	}
+
+	expr, err := parseTypeExpr(field.Type)
+	if err != nil {
+		return
+	}
+
+	lookup := p.lookupType
+
+	if field.enum != nil {
+		lookup = func(name string) (reflect.Type, bool) {
+			if name == field.enum.name {
+				return field.enum.typ, true
+			}
+			return p.lookupType(name)
+		}
+	}
+
+	typ, err = typeOf(expr, structType, lookup)
+
+	return
+}
+
+func (p *Builder) lookupType(name string) (typ reflect.Type, exist bool) {
+	p.locker.Lock()
+	typ, exist = p.registeredTypes[name]
+	p.locker.Unlock()
+
+	if !exist {
+		typ, exist = typeMap[name]
+	}
 
 	return
 }
@@ -275,6 +493,25 @@ func updateField(name string, newField Field, fields []Field) ([]Field, bool) {
 	return fields, updated
 }
 
+func findField(name string, fields []Field) (Field, bool) {
+	name = strings.TrimSpace(name)
+	name = strings.TrimPrefix(name, ".")
+
+	fieldNames := strings.SplitN(name, ".", 2)
+
+	for i := 0; i < len(fields); i++ {
+		if fields[i].Name == fieldNames[0] {
+			if len(fieldNames) == 1 {
+				return fields[i], true
+			}
+
+			return findField(fieldNames[1], fields[i].Children)
+		}
+	}
+
+	return Field{}, false
+}
+
 func deleteField(name string, fields []Field) ([]Field, bool) {
 	name = strings.TrimSpace(name)
 	name = strings.TrimPrefix(name, ".")
@@ -306,6 +543,47 @@ func deleteField(name string, fields []Field) ([]Field, bool) {
 	return fields, deleted
 }
 
+// copyFields deep copies fields with their resolved state
+func copyFields(fields []Field) []Field {
+	if fields == nil {
+		return nil
+	}
+
+	copied := make([]Field, len(fields))
+
+	for i := 0; i < len(fields); i++ {
+		copied[i] = fields[i]
+		copied[i].Children = copyFields(fields[i].Children)
+	}
+
+	return copied
+}
+
+// cloneFields deep copies fields without the children of resolved refs
+func cloneFields(fields []Field) []Field {
+	if fields == nil {
+		return nil
+	}
+
+	cloned := make([]Field, len(fields))
+
+	for i := 0; i < len(fields); i++ {
+		cloned[i] = fields[i]
+		cloned[i].refUpdated = false
+		cloned[i].lateRef = ""
+		cloned[i].enum = nil
+		cloned[i].scalar = nil
+
+		if len(fields[i].Ref) > 0 || fields[i].refUpdated {
+			cloned[i].Children = nil
+		} else {
+			cloned[i].Children = cloneFields(fields[i].Children)
+		}
+	}
+
+	return cloned
+}
+
 func indirect(reflectValue reflect.Value) reflect.Value {
 	for reflectValue.Kind() == reflect.Ptr {
 		reflectValue = reflectValue.Elem()
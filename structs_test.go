@@ -0,0 +1,85 @@
+package dmod
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuiltinTypes(t *testing.T) {
+	want := map[string]reflect.Type{
+		"bool":            reflect.TypeOf(false),
+		"string":          reflect.TypeOf(""),
+		"int":             reflect.TypeOf(int(0)),
+		"int8":            reflect.TypeOf(int8(0)),
+		"int16":           reflect.TypeOf(int16(0)),
+		"int32":           reflect.TypeOf(int32(0)),
+		"int64":           reflect.TypeOf(int64(0)),
+		"uint":            reflect.TypeOf(uint(0)),
+		"uint8":           reflect.TypeOf(uint8(0)),
+		"uint16":          reflect.TypeOf(uint16(0)),
+		"uint32":          reflect.TypeOf(uint32(0)),
+		"uint64":          reflect.TypeOf(uint64(0)),
+		"uintptr":         reflect.TypeOf(uintptr(0)),
+		"byte":            reflect.TypeOf(byte(0)),
+		"rune":            reflect.TypeOf(rune(0)),
+		"float32":         reflect.TypeOf(float32(0)),
+		"float64":         reflect.TypeOf(float64(0)),
+		"complex64":       reflect.TypeOf(complex64(0)),
+		"complex128":      reflect.TypeOf(complex128(0)),
+		"error":           reflect.TypeOf((*error)(nil)).Elem(),
+		"interface{}":     reflect.TypeOf((*interface{})(nil)).Elem(),
+		"any":             reflect.TypeOf((*interface{})(nil)).Elem(),
+		"struct":          reflect.TypeOf(struct{}{}),
+		"struct{}":        reflect.TypeOf(struct{}{}),
+		"time.Time":       reflect.TypeOf(time.Time{}),
+		"time.Duration":   reflect.TypeOf(time.Duration(0)),
+		"json.RawMessage": reflect.TypeOf(json.RawMessage{}),
+		"decimal":         reflect.TypeOf(Decimal{}),
+	}
+
+	for _, nameType := range builtinTypes {
+		if _, exist := want[nameType.Name]; !exist {
+			t.Errorf("builtin type %s is not tested", nameType.Name)
+		}
+	}
+
+	for name, typ := range want {
+		got, exist := typeMap[name]
+		if !exist {
+			t.Errorf("builtin type %s not exist", name)
+			continue
+		}
+		if got != typ {
+			t.Errorf("builtin type %s is %s, want %s", name, got, typ)
+		}
+	}
+}
+
+func TestComposedTypes(t *testing.T) {
+	cases := map[string]reflect.Type{
+		"*int16":                 reflect.TypeOf((*int16)(nil)),
+		"[]byte":                 reflect.TypeOf([]byte(nil)),
+		"map[string]string":      reflect.TypeOf(map[string]string(nil)),
+		"[4]byte":                reflect.TypeOf([4]byte{}),
+		"[]*time.Time":           reflect.TypeOf([]*time.Time(nil)),
+		"map[string][]int":       reflect.TypeOf(map[string][]int(nil)),
+		"map[int64]*decimal":     reflect.TypeOf(map[int64]*Decimal(nil)),
+		"**string":               reflect.TypeOf((**string)(nil)),
+		"[][]interface{}":        reflect.TypeOf([][]interface{}(nil)),
+		"map[string]struct{}":    reflect.TypeOf(map[string]struct{}(nil)),
+		" map[ string ] []bool ": reflect.TypeOf(map[string][]bool(nil)),
+	}
+
+	for src, want := range cases {
+		got, err := NewBuilder().(*Builder).fieldType(Field{Name: "F", Type: src}, nil)
+		if err != nil {
+			t.Errorf("type %q, %s", src, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("type %q is %s, want %s", src, got, want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package dmod
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TagPolicy generates the tag Key for every field which does not declare
+// it, the value is the field name converted by Naming, e.g. SnakeCase,
+// pointer fields get `,omitempty` when OmitEmptyPointer is set
+type TagPolicy struct {
+	Key              string
+	Naming           func(name string) string
+	OmitEmptyPointer bool
+}
+
+func (p TagPolicy) value(field Field, typ reflect.Type) string {
+	value := field.Name
+	if p.Naming != nil {
+		value = p.Naming(field.Name)
+	}
+
+	if p.OmitEmptyPointer && typ.Kind() == reflect.Ptr {
+		value += ",omitempty"
+	}
+
+	return value
+}
+
+// StructTag renders the tag of the field, keys of Tags override the same
+// keys of the raw Tag, the result is sorted by key so it is canonical
+func (p *Field) StructTag() reflect.StructTag {
+	if len(p.Tags) == 0 {
+		return reflect.StructTag(p.Tag)
+	}
+
+	return renderStructTag(p.tagValues())
+}
+
+// GetTag returns the value of key in Tags or in the raw Tag
+func (p *Field) GetTag(key string) (value string, exist bool) {
+	value, exist = p.Tags[key]
+	if exist {
+		return
+	}
+
+	return reflect.StructTag(p.Tag).Lookup(key)
+}
+
+// SetTag sets the value of key, Tags is copied before it is changed
+// because copies of a field share the same map
+func (p *Field) SetTag(key, value string) {
+	p.MergeTags(map[string]string{key: value})
+}
+
+// DeleteTag removes key from both Tags and the raw Tag
+func (p *Field) DeleteTag(key string) {
+	values := p.tagValues()
+	delete(values, key)
+
+	p.Tag = ""
+	p.Tags = values
+}
+
+// MergeTags sets every key of tags, other keys are kept
+func (p *Field) MergeTags(tags map[string]string) {
+	merged := make(map[string]string, len(p.Tags)+len(tags))
+
+	for k, v := range p.Tags {
+		merged[k] = v
+	}
+
+	for k, v := range tags {
+		merged[k] = v
+	}
+
+	p.Tags = merged
+}
+
+func (p *Field) tagValues() map[string]string {
+	values := parseStructTag(p.Tag)
+
+	for k, v := range p.Tags {
+		values[k] = v
+	}
+
+	return values
+}
+
+func renderStructTag(values map[string]string) reflect.StructTag {
+	var keys []string
+	for k := range values {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	var items []string
+	for _, k := range keys {
+		items = append(items, k+":"+strconv.Quote(values[k]))
+	}
+
+	return reflect.StructTag(strings.Join(items, " "))
+}
+
+// parseStructTag splits a conventional struct tag into its key value pairs,
+// it follows the same rules as reflect.StructTag.Lookup
+func parseStructTag(tag string) map[string]string {
+	values := map[string]string{}
+
+	for tag != "" {
+		i := 0
+		for i < len(tag) && tag[i] == ' ' {
+			i++
+		}
+		tag = tag[i:]
+		if tag == "" {
+			break
+		}
+
+		i = 0
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
+		if i == 0 || i+1 >= len(tag) || tag[i] != ':' || tag[i+1] != '"' {
+			break
+		}
+		name := tag[:i]
+		tag = tag[i+1:]
+
+		i = 1
+		for i < len(tag) && tag[i] != '"' {
+			if tag[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(tag) {
+			break
+		}
+		qvalue := tag[:i+1]
+		tag = tag[i+1:]
+
+		value, err := strconv.Unquote(qvalue)
+		if err != nil {
+			break
+		}
+
+		values[name] = value
+	}
+
+	return values
+}
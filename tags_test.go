@@ -0,0 +1,82 @@
+package dmod
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFieldTags(t *testing.T) {
+	field := Field{
+		Name: "ID",
+		Tag:  `json:"id" gorm:"column:id"`,
+		Tags: map[string]string{"json": "id,omitempty", "db": "id"},
+	}
+
+	want := reflect.StructTag(`db:"id" gorm:"column:id" json:"id,omitempty"`)
+	if got := field.StructTag(); got != want {
+		t.Errorf("struct tag got %s, want %s", got, want)
+	}
+
+	if value, exist := field.GetTag("gorm"); !exist || value != "column:id" {
+		t.Errorf("raw tag got %q, %v", value, exist)
+	}
+
+	if value, exist := field.GetTag("json"); !exist || value != "id,omitempty" {
+		t.Errorf("tags got %q, %v", value, exist)
+	}
+
+	shared := field
+	field.SetTag("db", "uid")
+
+	if shared.Tags["db"] != "id" {
+		t.Error("SetTag should not change copies of the field")
+	}
+
+	field.DeleteTag("gorm")
+	if _, exist := field.GetTag("gorm"); exist {
+		t.Error("DeleteTag should remove keys of the raw tag")
+	}
+
+	field.MergeTags(map[string]string{"yaml": "id"})
+
+	want = `db:"uid" json:"id,omitempty" yaml:"id"`
+	if got := field.StructTag(); got != want {
+		t.Errorf("merged tag got %s, want %s", got, want)
+	}
+
+	raw := Field{Name: "ID", Tag: `json:"id"`}
+	if got := raw.StructTag(); got != `json:"id"` {
+		t.Errorf("raw tag should be kept as it is, got %s", got)
+	}
+}
+
+func TestModelMergeTags(t *testing.T) {
+	models, _ := NewModels()
+
+	err := models.LoadModels([]string{
+		`{"name":"user","fields":[{"name":"ID","type":"uint","tag":"json:\"id\""}]}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, _ := models.GetModel("user")
+
+	model, updated, err := user.MergeTags(".ID", map[string]string{"db": "id"})
+	if err != nil || !updated {
+		t.Fatalf("merge tags got %v, %v", updated, err)
+	}
+
+	structField, _ := model.Type().FieldByName("ID")
+	if structField.Tag != `db:"id" json:"id"` {
+		t.Errorf("rebuilt tag got %s", structField.Tag)
+	}
+
+	if latest, _ := models.GetModel("user"); latest != model {
+		t.Error("merged model should be published")
+	}
+
+	if _, updated, err = model.MergeTags(".Missing", map[string]string{"db": "x"}); err != nil || updated {
+		t.Errorf("merge tags of a missing field got %v, %v", updated, err)
+	}
+}
@@ -0,0 +1,344 @@
+package dmod
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// maxArrayLength and maxArraySize limit the arrays of type expressions, so
+// that a schema could not make Model.New allocate without bound
+const (
+	maxArrayLength = 1 << 16
+	maxArraySize   = 1 << 26
+)
+
+type typeExprKind int
+
+const (
+	typeExprName typeExprKind = iota
+	typeExprPtr
+	typeExprSlice
+	typeExprArray
+	typeExprMap
+)
+
+// typeExpr is a parsed Field.Type, e.g. `map[string][]*time.Time`, args
+// are the arguments of a generic model, e.g. `page<user>`
+type typeExpr struct {
+	kind   typeExprKind
+	name   string
+	args   []*typeExpr
+	length int
+	key    *typeExpr
+	elem   *typeExpr
+}
+
+// baseName returns the name at the bottom of the element chain with its
+// generic arguments, map keys are not part of the chain
+func (p *typeExpr) baseName() string {
+	for p.elem != nil {
+		p = p.elem
+	}
+	return p.String()
+}
+
+// String renders the expression in its canonical form, generic arguments
+// are joined by commas without spaces
+func (p *typeExpr) String() string {
+	switch p.kind {
+	case typeExprPtr:
+		return "*" + p.elem.String()
+	case typeExprSlice:
+		return "[]" + p.elem.String()
+	case typeExprArray:
+		return "[" + strconv.Itoa(p.length) + "]" + p.elem.String()
+	case typeExprMap:
+		return "map[" + p.key.String() + "]" + p.elem.String()
+	}
+
+	if len(p.args) == 0 {
+		return p.name
+	}
+
+	var args []string
+	for _, arg := range p.args {
+		args = append(args, arg.String())
+	}
+
+	return p.name + "<" + strings.Join(args, ",") + ">"
+}
+
+// substitute returns a copy of the expression with the names of params
+// replaced by their arguments
+func (p *typeExpr) substitute(params map[string]*typeExpr) *typeExpr {
+	if p == nil {
+		return nil
+	}
+
+	if arg, exist := params[p.name]; exist && p.kind == typeExprName && len(p.args) == 0 {
+		return arg
+	}
+
+	expr := *p
+	expr.key = p.key.substitute(params)
+	expr.elem = p.elem.substitute(params)
+	expr.args = nil
+
+	for _, arg := range p.args {
+		expr.args = append(expr.args, arg.substitute(params))
+	}
+
+	return &expr
+}
+
+// rename returns a copy of the expression with every name replaced by fn,
+// names of generic models and their arguments included
+func (p *typeExpr) rename(fn func(name string) string) *typeExpr {
+	if p == nil {
+		return nil
+	}
+
+	expr := *p
+	expr.key = p.key.rename(fn)
+	expr.elem = p.elem.rename(fn)
+	expr.args = nil
+
+	if p.kind == typeExprName {
+		expr.name = fn(p.name)
+	}
+
+	for _, arg := range p.args {
+		expr.args = append(expr.args, arg.rename(fn))
+	}
+
+	return &expr
+}
+
+// eachGeneric calls fn with every generic name of the expression, the
+// arguments are visited before the names holding them
+func (p *typeExpr) eachGeneric(fn func(expr *typeExpr)) {
+	if p == nil {
+		return
+	}
+
+	for _, arg := range p.args {
+		arg.eachGeneric(fn)
+	}
+
+	p.key.eachGeneric(fn)
+	p.elem.eachGeneric(fn)
+
+	if len(p.args) > 0 {
+		fn(p)
+	}
+}
+
+type typeExprParser struct {
+	src string
+	pos int
+}
+
+func parseTypeExpr(src string) (expr *typeExpr, err error) {
+	parser := &typeExprParser{src: src}
+
+	expr, err = parser.parse()
+	if err != nil {
+		return
+	}
+
+	parser.skipSpace()
+
+	if parser.pos != len(parser.src) {
+		err = fmt.Errorf("invalid type %s, unexpected %q at %d", src, parser.src[parser.pos:], parser.pos)
+		expr = nil
+	}
+
+	return
+}
+
+func (p *typeExprParser) parse() (expr *typeExpr, err error) {
+	p.skipSpace()
+
+	switch {
+	case p.consume("*"):
+		expr = &typeExpr{kind: typeExprPtr}
+	case p.consume("[]"):
+		expr = &typeExpr{kind: typeExprSlice}
+	case p.consume("map["):
+		expr = &typeExpr{kind: typeExprMap}
+
+		expr.key, err = p.parse()
+		if err != nil {
+			return
+		}
+
+		p.skipSpace()
+
+		if !p.consume("]") {
+			err = p.errorf("expect ] after map key")
+			return
+		}
+	case p.consume("["):
+		start := p.pos
+		for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+			p.pos++
+		}
+
+		digits := p.src[start:p.pos]
+
+		length, convErr := strconv.Atoi(digits)
+		if errors.Is(convErr, strconv.ErrRange) || length > maxArrayLength {
+			p.pos = start
+			err = p.errorf("array length %s exceeds %d", digits, maxArrayLength)
+			return
+		}
+
+		if convErr != nil || !p.consume("]") {
+			err = p.errorf("invalid array length")
+			return
+		}
+
+		expr = &typeExpr{kind: typeExprArray, length: length}
+	default:
+		name := p.name()
+		if len(name) == 0 {
+			err = p.errorf("expect type name")
+			return
+		}
+
+		expr = &typeExpr{kind: typeExprName, name: name}
+
+		p.skipSpace()
+
+		if p.consume("<") {
+			for {
+				var arg *typeExpr
+				arg, err = p.parse()
+				if err != nil {
+					return
+				}
+
+				expr.args = append(expr.args, arg)
+
+				p.skipSpace()
+
+				if p.consume(">") {
+					break
+				}
+
+				if !p.consume(",") {
+					err = p.errorf("expect , or > after generic argument")
+					return
+				}
+			}
+		}
+
+		return
+	}
+
+	expr.elem, err = p.parse()
+
+	return
+}
+
+func (p *typeExprParser) name() string {
+	for _, keyword := range []string{"interface{}", "struct{}"} {
+		if p.consume(keyword) {
+			return keyword
+		}
+	}
+
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '_' || c == '.' || c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80 {
+			p.pos++
+			continue
+		}
+		break
+	}
+
+	return p.src[start:p.pos]
+}
+
+func (p *typeExprParser) consume(token string) bool {
+	if strings.HasPrefix(p.src[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *typeExprParser) skipSpace() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *typeExprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid type %s at %d, %s", p.src, p.pos, fmt.Sprintf(format, args...))
+}
+
+// typeOf composes the reflect.Type of expr, names are looked up by lookup,
+// when base is not nil it replaces the name at the bottom of the element
+// chain, it is the struct built from the children of the field
+func typeOf(expr *typeExpr, base reflect.Type, lookup func(name string) (reflect.Type, bool)) (typ reflect.Type, err error) {
+
+	switch expr.kind {
+	case typeExprName:
+		if base != nil {
+			typ = base
+			return
+		}
+
+		var exist bool
+		typ, exist = lookup(expr.String())
+		if !exist {
+			err = fmt.Errorf("type %s not register", expr.String())
+		}
+		return
+	case typeExprMap:
+		var keyType reflect.Type
+		keyType, err = typeOf(expr.key, nil, lookup)
+		if err != nil {
+			return
+		}
+
+		if !keyType.Comparable() {
+			err = fmt.Errorf("invalid map key type %s", keyType)
+			return
+		}
+
+		var elemType reflect.Type
+		elemType, err = typeOf(expr.elem, base, lookup)
+		if err != nil {
+			return
+		}
+
+		typ = reflect.MapOf(keyType, elemType)
+		return
+	}
+
+	elemType, err := typeOf(expr.elem, base, lookup)
+	if err != nil {
+		return
+	}
+
+	switch expr.kind {
+	case typeExprPtr:
+		typ = reflect.PtrTo(elemType)
+	case typeExprSlice:
+		typ = reflect.SliceOf(elemType)
+	case typeExprArray:
+		if elemType.Size() > 0 && uintptr(expr.length) > maxArraySize/elemType.Size() {
+			err = fmt.Errorf("array type %s exceeds %d bytes", expr.String(), maxArraySize)
+			return
+		}
+		typ = reflect.ArrayOf(expr.length, elemType)
+	}
+
+	return
+}
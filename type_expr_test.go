@@ -0,0 +1,67 @@
+package dmod
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTypeExpr(t *testing.T) {
+	cases := map[string]string{
+		"int":                      "int",
+		" *time.Time ":             "*time.Time",
+		"[]*string":                "[]*string",
+		"[4]byte":                  "[4]byte",
+		"map[string][]int":         "map[string][]int",
+		"map[ string ]*address":    "map[string]*address",
+		"page<user>":               "page<user>",
+		"pair< string , []user >":  "pair<string,[]user>",
+		"[]map[string]page<user>":  "[]map[string]page<user>",
+		"interface{}":              "interface{}",
+		"map[string]struct{}":      "map[string]struct{}",
+		"billing.address":          "billing.address",
+		"[65536]byte":              "[65536]byte",
+		"map[int]pair<int,string>": "map[int]pair<int,string>",
+	}
+
+	for src, want := range cases {
+		expr, err := parseTypeExpr(src)
+		if err != nil {
+			t.Errorf("parse %q: %v", src, err)
+			continue
+		}
+
+		if got := expr.String(); got != want {
+			t.Errorf("parse %q got %s, want %s", src, got, want)
+		}
+	}
+}
+
+func TestParseTypeExprErrors(t *testing.T) {
+	cases := map[string]string{
+		"":                          "at 0, expect type name",
+		"[]":                        "at 2, expect type name",
+		"map[string":                "at 10, expect ] after map key",
+		"[x]int":                    "at 1, invalid array length",
+		"[65537]int":                "at 1, array length 65537 exceeds 65536",
+		"[999999999999999999]int":   "at 1, array length 999999999999999999 exceeds 65536",
+		"[99999999999999999999]int": "at 1, array length 99999999999999999999 exceeds 65536",
+		"page<user":                 "at 9, expect , or > after generic argument",
+		"int string":                `unexpected "string" at 4`,
+	}
+
+	for src, want := range cases {
+		_, err := parseTypeExpr(src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parse %q got %v, want %q", src, err, want)
+		}
+	}
+}
+
+func TestArrayTypeSize(t *testing.T) {
+	models, _ := NewModels()
+
+	err := models.LoadModels([]string{`{"name":"grid","fields":[{"name":"Cells","type":"[65536][65536]int"}]}`})
+	if err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("expect a size error, got %v", err)
+	}
+}
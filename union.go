@@ -0,0 +1,361 @@
+package dmod
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+const defaultDiscriminator = "type"
+
+var (
+	typeOfOneOf = reflect.TypeOf(OneOf{})
+)
+
+// OneOf is the value of a union field declared by `oneOf`, e.g. a payment
+// which is either a `card` or a `bank_transfer`, the value is an instance
+// of one of the models, in json it is the object of the instance with the
+// name of the model in the discriminator property, `type` by default
+type OneOf struct {
+	field    *Field
+	registry map[string]*Model
+
+	model *Model
+	value reflect.Value
+
+	// raw is the json decoded before the union was bound
+	raw json.RawMessage
+}
+
+// Variant returns the name of the model of the value, empty if it is unset
+func (p *OneOf) Variant() string {
+	if p.model == nil {
+		return ""
+	}
+	return p.model.Name()
+}
+
+// Model returns the model of the value, nil if it is unset
+func (p *OneOf) Model() *Model {
+	return p.model
+}
+
+// Variants returns the names of the models the value could be
+func (p *OneOf) Variants() []string {
+	if p.field == nil {
+		return nil
+	}
+	return append([]string{}, p.field.OneOf...)
+}
+
+// Interface returns the instance, e.g. `*card`, nil if it is unset
+func (p *OneOf) Interface() interface{} {
+	if !p.value.IsValid() {
+		return nil
+	}
+	return p.value.Interface()
+}
+
+// Set sets the value to an instance of one of the models, the model is
+// found by the type of value, nil resets it
+func (p *OneOf) Set(value interface{}) (err error) {
+
+	reflectValue, ok := value.(reflect.Value)
+	if !ok {
+		reflectValue = reflect.ValueOf(value)
+	}
+
+	if !reflectValue.IsValid() || reflectValue.Kind() == reflect.Ptr && reflectValue.IsNil() {
+		p.reset()
+		return
+	}
+
+	if p.field == nil {
+		err = errors.New("union is not bound")
+		return
+	}
+
+	if reflectValue.Kind() != reflect.Ptr {
+		ptr := reflect.New(reflectValue.Type())
+		ptr.Elem().Set(reflectValue)
+		reflectValue = ptr
+	}
+
+	for _, variant := range p.field.OneOf {
+		model, exist := p.registry[canonicalName(variant)]
+		if exist && model.Type() == reflectValue.Type().Elem() {
+			p.model = model
+			p.value = reflectValue
+			p.raw = nil
+			return
+		}
+	}
+
+	err = fmt.Errorf("value of type %s is not one of %v", reflectValue.Type(), p.field.OneOf)
+
+	return
+}
+
+// New sets the value to a new instance of the model variant and returns it
+func (p *OneOf) New(variant string) (instance interface{}, err error) {
+	model, err := p.variantModel(variant)
+	if err != nil {
+		return
+	}
+
+	instance = model.New()
+
+	p.model = model
+	p.value = reflect.ValueOf(instance)
+	p.raw = nil
+
+	return
+}
+
+func (p *OneOf) reset() {
+	p.model = nil
+	p.value = reflect.Value{}
+	p.raw = nil
+}
+
+func (p *OneOf) discriminator() string {
+	if p.field == nil || len(p.field.Discriminator) == 0 {
+		return defaultDiscriminator
+	}
+	return p.field.Discriminator
+}
+
+func (p *OneOf) variantModel(variant string) (model *Model, err error) {
+	if p.field == nil {
+		err = errors.New("union is not bound")
+		return
+	}
+
+	for _, name := range p.field.OneOf {
+		if canonicalName(name) != canonicalName(variant) {
+			continue
+		}
+
+		model, exist := p.registry[canonicalName(name)]
+		if !exist {
+			return nil, fmt.Errorf("model %s not exist", name)
+		}
+
+		return model, nil
+	}
+
+	err = fmt.Errorf("%s is not one of %v", variant, p.field.OneOf)
+
+	return
+}
+
+// MarshalJSON writes the instance with the discriminator, the instance
+// keeps its own property if it declares one with the same name
+func (p OneOf) MarshalJSON() ([]byte, error) {
+	if !p.value.IsValid() {
+		if p.raw != nil {
+			return p.raw, nil
+		}
+		return []byte("null"), nil
+	}
+
+	data, err := p.model.encodeJSON(p.value)
+	if err != nil {
+		return nil, err
+	}
+
+	var object map[string]json.RawMessage
+	if err = json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+
+	if _, exist := object[p.discriminator()]; exist {
+		return data, nil
+	}
+
+	key, _ := json.Marshal(p.discriminator())
+	variant, _ := json.Marshal(p.model.Name())
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	buf.Write(key)
+	buf.WriteByte(':')
+	buf.Write(variant)
+	if len(object) > 0 {
+		buf.WriteByte(',')
+	}
+	buf.Write(bytes.TrimSpace(data)[1:])
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON keeps the data until the union is bound to its field, a
+// bound union decodes it into a new instance of the model named by the
+// discriminator at once
+func (p *OneOf) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		p.reset()
+		return nil
+	}
+
+	p.reset()
+	p.raw = append(json.RawMessage{}, data...)
+
+	if p.field == nil {
+		return nil
+	}
+
+	return p.resolve()
+}
+
+// bind binds the union to its field and the models of the generation
+func (p *OneOf) bind(field *Field, registry map[string]*Model) {
+	p.field = field
+	p.registry = registry
+}
+
+// resolve decodes the raw json into an instance of the model named by the
+// discriminator, the instance is validated
+func (p *OneOf) resolve() (err error) {
+	if p.raw == nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("invalid value of union %s, %w", p.field.Name, err)
+		}
+	}()
+
+	raw := p.raw
+
+	var object map[string]json.RawMessage
+	if err = json.Unmarshal(raw, &object); err != nil {
+		return
+	}
+
+	tag, exist := object[p.discriminator()]
+	if !exist {
+		err = fmt.Errorf("discriminator %s is missing", p.discriminator())
+		return
+	}
+
+	var variant string
+	if err = json.Unmarshal(tag, &variant); err != nil {
+		err = fmt.Errorf("discriminator %s must be a string", p.discriminator())
+		return
+	}
+
+	model, err := p.variantModel(variant)
+	if err != nil {
+		return
+	}
+
+	instance := model.New()
+
+	if err = model.decodeJSON(raw, reflect.ValueOf(instance)); err != nil {
+		return
+	}
+
+	if err = model.Validate(instance); err != nil {
+		return
+	}
+
+	p.model = model
+	p.value = reflect.ValueOf(instance)
+	p.raw = nil
+
+	return
+}
+
+// hasUnions reports whether fields hold union fields out of refs
+func hasUnions(fields []Field) bool {
+	for i := 0; i < len(fields); i++ {
+		if len(fields[i].OneOf) > 0 {
+			return true
+		}
+
+		if len(fields[i].lateRef) == 0 && hasUnions(fields[i].Children) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bindUnions binds every union of the instance v to its field and the
+// models of the generation, json kept by unions is decoded
+func (p *Model) bindUnions(fields []Field, v reflect.Value) (err error) {
+
+	v = indirect(v)
+
+	if !v.IsValid() || v.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < len(fields); i++ {
+		field := &fields[i]
+
+		fieldValue := v.FieldByName(field.Name)
+		if !fieldValue.IsValid() {
+			continue
+		}
+
+		switch {
+		case len(field.OneOf) > 0:
+			err = eachOneOf(fieldValue, func(union *OneOf) error {
+				union.bind(field, p.registry)
+				return union.resolve()
+			})
+		case len(field.lateRef) == 0 && len(field.Children) > 0:
+			err = eachStruct(fieldValue, func(st reflect.Value) error {
+				return p.bindUnions(field.Children, st)
+			})
+		}
+
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// eachOneOf calls fn with every union held by v through pointers, slices,
+// arrays and maps, entries of maps are copied and stored back
+func eachOneOf(v reflect.Value, fn func(union *OneOf) error) (err error) {
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		return eachOneOf(v.Elem(), fn)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err = eachOneOf(v.Index(i), fn); err != nil {
+				return
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			entry := reflect.New(v.Type().Elem()).Elem()
+			entry.Set(iter.Value())
+
+			if err = eachOneOf(entry, fn); err != nil {
+				return
+			}
+
+			v.SetMapIndex(iter.Key(), entry)
+		}
+	case reflect.Struct:
+		if v.Type() == typeOfOneOf && v.CanAddr() {
+			err = fn(v.Addr().Interface().(*OneOf))
+		}
+	}
+
+	return
+}
@@ -0,0 +1,81 @@
+package dmod
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnion(t *testing.T) {
+	models, _ := NewModels()
+
+	err := models.LoadModels([]string{
+		`{"name":"card","fields":[{"name":"Number","type":"string","tag":"json:\"number\""}]}`,
+		`{"name":"bank","fields":[{"name":"IBAN","type":"string","tag":"json:\"iban\""}]}`,
+		`{"name":"order","fields":[{"name":"Payment","oneOf":["card","bank"],"tag":"json:\"payment\""},{"name":"Refunds","oneOf":["card","bank"],"array":true,"discriminator":"kind","tag":"json:\"refunds\""}]}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order, _ := models.GetModel("order")
+
+	data := `{"payment":{"type":"card","number":"4111"},"refunds":[{"kind":"bank","iban":"DE89"}]}`
+
+	v, err := order.Decode([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if variant := order.Field(v, "Payment").Variant(); variant != "card" {
+		t.Errorf("variant got %q", variant)
+	}
+
+	var number string
+	if err = order.Field(v, "Payment.Number").Value(&number); err != nil || number != "4111" {
+		t.Errorf("number got %q, %v", number, err)
+	}
+
+	encoded, err := order.Encode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(encoded) != data {
+		t.Errorf("encode got\n%s\nwant\n%s", encoded, data)
+	}
+
+	bank, _ := models.GetModel("bank")
+	if err = order.Field(v, "Payment").Set(bank.New()); err != nil {
+		t.Fatal(err)
+	}
+
+	if variant := order.Field(v, "Payment").Variant(); variant != "bank" {
+		t.Errorf("variant after set got %q", variant)
+	}
+
+	if err = order.Field(v, "Payment").Set(order.New()); err == nil {
+		t.Error("set of a model out of the variants should fail")
+	}
+
+	errCases := map[string]string{
+		`{"payment":{"type":"cash"}}`:       "cash is not one of",
+		`{"payment":{"number":"4111"}}`:     "discriminator type is missing",
+		`{"payment":{"type":1}}`:            "discriminator type must be a string",
+		`{"refunds":[{"type":"bank"}]}`:     "discriminator kind is missing",
+		`{"payment":{"type":"card"},"x":1}`: "",
+	}
+
+	for input, want := range errCases {
+		_, err = order.Decode([]byte(input))
+		if len(want) == 0 {
+			if err != nil {
+				t.Errorf("decode %s got %v", input, err)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("decode %s got %v, want %q", input, err, want)
+		}
+	}
+}
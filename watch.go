@@ -0,0 +1,387 @@
+package dmod
+
+import (
+	"context"
+	"crypto/sha1"
+	"io/fs"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type ModelEventType int
+
+const (
+	ModelAdded ModelEventType = iota + 1
+	ModelUpdated
+	ModelRemoved
+)
+
+func (p ModelEventType) String() string {
+	switch p {
+	case ModelAdded:
+		return "added"
+	case ModelUpdated:
+		return "updated"
+	case ModelRemoved:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// ModelEvent is emitted by Watch for every model replaced by a reload,
+// Old is nil for added models and New is nil for removed models
+type ModelEvent struct {
+	Type ModelEventType
+	Name string
+	Old  *Model
+	New  *Model
+}
+
+type watchOptions struct {
+	interval time.Duration
+	onError  func(error)
+}
+
+type WatchOption func(*watchOptions) error
+
+func WatchOptInterval(interval time.Duration) WatchOption {
+	return func(o *watchOptions) error {
+		o.interval = interval
+		return nil
+	}
+}
+
+func WatchOptErrorHandler(fn func(error)) WatchOption {
+	return func(o *watchOptions) error {
+		o.onError = fn
+		return nil
+	}
+}
+
+type watchedFile struct {
+	sum    [sha1.Size]byte
+	models []string
+	enums  []string
+}
+
+type dirWatcher struct {
+	models  *Models
+	dir     string
+	options watchOptions
+
+	files   map[string]*watchedFile
+	lastErr string
+	events  chan ModelEvent
+}
+
+// Watch loads the models of dir and polls it until ctx is done, added, changed
+// and removed files are reloaded together with the models depending on them,
+// every reload is atomic and emits one event per replaced model, the channel
+// is closed when ctx is done
+func (p *Models) Watch(ctx context.Context, dir string, opts ...WatchOption) (events <-chan ModelEvent, err error) {
+
+	options := watchOptions{
+		interval: time.Second,
+		onError: func(err error) {
+			logrus.WithField("dir", dir).WithError(err).Errorln("reload models failed")
+		},
+	}
+
+	for i := 0; i < len(opts); i++ {
+		err = opts[i](&options)
+		if err != nil {
+			return
+		}
+	}
+
+	watcher := &dirWatcher{
+		models:  p,
+		dir:     dir,
+		options: options,
+		files:   map[string]*watchedFile{},
+		events:  make(chan ModelEvent),
+	}
+
+	_, err = watcher.sync()
+	if err != nil {
+		return
+	}
+
+	go watcher.run(ctx)
+
+	events = watcher.events
+
+	return
+}
+
+func (p *dirWatcher) run(ctx context.Context) {
+
+	defer close(p.events)
+
+	ticker := time.NewTicker(p.options.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		events, err := p.sync()
+		if err != nil {
+			if err.Error() != p.lastErr {
+				p.lastErr = err.Error()
+				p.options.onError(err)
+			}
+			continue
+		}
+
+		p.lastErr = ""
+
+		for _, event := range events {
+			select {
+			case p.events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// sync scans the directory and reloads the models of changed files, every
+// file is compared by its checksum because a rewrite could keep the size and
+// the modification time, the records of files are only updated when the
+// reload succeeded, so a failed reload is retried at the next poll
+func (p *dirWatcher) sync() (events []ModelEvent, err error) {
+
+	seen := map[string]bool{}
+	changed := map[string]*watchedFile{}
+	changedConfigs := map[string]*ModelConfig{}
+	changedEnums := map[string]*EnumConfig{}
+	loaded := map[string]string{}
+
+	var errs SchemaErrors
+
+	fsys := os.DirFS(p.dir)
+
+	walkFn := func(name string, d fs.DirEntry) (walkErr error) {
+
+		data, walkErr := fs.ReadFile(fsys, name)
+		if walkErr != nil {
+			return
+		}
+
+		seen[name] = true
+
+		newRecord := &watchedFile{sum: sha1.Sum(data)}
+
+		if record, exist := p.files[name]; exist && record.sum == newRecord.sum {
+			return
+		}
+
+		modelConfigs, enumConfigs, decodeErr := decodeModelConfigs(joinModelPath(p.dir, name), p.models.dirPackage(".", name), data)
+		if decodeErr != nil {
+			errs.add(decodeErr)
+			return
+		}
+
+		for i := 0; i < len(enumConfigs); i++ {
+			newRecord.enums = append(newRecord.enums, enumConfigs[i].name)
+			changedEnums[enumConfigs[i].name] = &enumConfigs[i]
+		}
+
+		for i := 0; i < len(modelConfigs); i++ {
+			newRecord.models = append(newRecord.models, modelConfigs[i].Name)
+		}
+
+		addModelConfigs(changedConfigs, loaded, modelConfigs, "", &errs)
+
+		changed[name] = newRecord
+
+		return
+	}
+
+	err = walkModelFiles(fsys, ".", walkFn)
+	if err != nil {
+		return
+	}
+
+	if len(errs) > 0 {
+		err = errs
+		return
+	}
+
+	var removed []string
+	for path := range p.files {
+		if !seen[path] {
+			removed = append(removed, path)
+		}
+	}
+
+	if len(changed) == 0 && len(removed) == 0 {
+		return
+	}
+
+	affected := map[string]bool{}
+	affectedEnums := map[string]bool{}
+
+	for _, path := range removed {
+		for _, name := range p.files[path].models {
+			affected[name] = true
+		}
+		for _, name := range p.files[path].enums {
+			affectedEnums[name] = true
+		}
+	}
+
+	for path := range changed {
+		if record, exist := p.files[path]; exist {
+			for _, name := range record.models {
+				affected[name] = true
+			}
+			for _, name := range record.enums {
+				affectedEnums[name] = true
+			}
+		}
+	}
+
+	for name := range changedConfigs {
+		affected[name] = true
+	}
+
+	for name := range changedEnums {
+		affectedEnums[name] = true
+	}
+
+	events, err = p.models.reloadModels(changedConfigs, affected, changedEnums, affectedEnums)
+	if err != nil {
+		return
+	}
+
+	for _, path := range removed {
+		delete(p.files, path)
+	}
+
+	for path, record := range changed {
+		p.files[path] = record
+	}
+
+	return
+}
+
+// reloadModels replaces the affected models by configs and the affected
+// enums by enumConfigs, affected ones without a new config are removed,
+// only the affected models and their dependents are built again, the others
+// keep their instances, every model is built again when enums changed
+func (p *Models) reloadModels(configs map[string]*ModelConfig, affected map[string]bool, enumConfigs map[string]*EnumConfig, affectedEnums map[string]bool) (events []ModelEvent, err error) {
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	current := p.Snapshot()
+
+	allModels := current.copyModelsConfig()
+
+	for name := range affected {
+		delete(allModels, name)
+	}
+
+	for name, config := range configs {
+		allModels[name] = config
+	}
+
+	enums := current.enums
+
+	if len(affectedEnums) > 0 {
+		allEnums := current.copyEnumsConfig()
+
+		for name := range affectedEnums {
+			delete(allEnums, name)
+		}
+
+		for name, config := range enumConfigs {
+			allEnums[name] = config
+		}
+
+		enums, err = buildEnums(allEnums, p.lookupType)
+		if err != nil {
+			return
+		}
+	}
+
+	err = resolveModelConfigs(allModels, enums)
+	if err != nil {
+		return
+	}
+
+	var rebuild []string
+
+	if len(affectedEnums) > 0 {
+		for name := range allModels {
+			rebuild = append(rebuild, name)
+		}
+	} else {
+		for _, name := range dependentModels(allModels, affected) {
+			if _, exist := allModels[name]; exist {
+				rebuild = append(rebuild, name)
+			}
+		}
+	}
+
+	built, err := p.buildModels(allModels, rebuild)
+	if err != nil {
+		return
+	}
+
+	instances := current.copyModelsInstance()
+
+	for name := range affected {
+		delete(instances, name)
+	}
+
+	for name, model := range built {
+		instances[name] = model
+		model.registry = instances
+	}
+
+	p.publish(instances, allModels, enums)
+
+	var names []string
+	for name := range affected {
+		names = append(names, name)
+	}
+
+	for name := range built {
+		if !affected[name] {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		oldModel := current.modelsInstance[name]
+		newModel := instances[name]
+
+		event := ModelEvent{Name: name, Old: oldModel, New: newModel}
+
+		switch {
+		case oldModel == nil && newModel == nil:
+			continue
+		case oldModel == nil:
+			event.Type = ModelAdded
+		case newModel == nil:
+			event.Type = ModelRemoved
+		default:
+			event.Type = ModelUpdated
+		}
+
+		events = append(events, event)
+	}
+
+	return
+}
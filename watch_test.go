@@ -0,0 +1,145 @@
+package dmod
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	tmp := t.TempDir()
+
+	// write replaces the file by a rename, so the watcher never reads a
+	// partly written file
+	write := func(name, data string) {
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(filepath.Join(tmp, name), filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("address.json", `{"name":"address","fields":[{"name":"City","type":"string"}]}`)
+	write("user.json", `{"name":"user","fields":[{"name":"Home","ref":"address"}]}`)
+
+	models, _ := NewModels()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errs := make(chan error, 16)
+
+	events, err := models.Watch(ctx, dir, WatchOptInterval(10*time.Millisecond), WatchOptErrorHandler(func(err error) {
+		errs <- err
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := func() map[string]ModelEventType {
+		got := map[string]ModelEventType{}
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case event := <-events:
+				got[event.Name] = event.Type
+			case err := <-errs:
+				t.Fatalf("unexpected reload error, %s", err)
+			case <-time.After(200 * time.Millisecond):
+				if len(got) > 0 {
+					return got
+				}
+			case <-timeout:
+				t.Fatal("no event")
+			}
+		}
+	}
+
+	write("address.json", `{"name":"address","fields":[{"name":"City","type":"string"},{"name":"Zip","type":"string"}]}`)
+
+	got := next()
+	if got["address"] != ModelUpdated || got["user"] != ModelUpdated {
+		t.Fatalf("expect address and its dependent user updated, got %v", got)
+	}
+
+	user, _ := models.GetModel("user")
+	if _, exist := user.GetField(".Home.Zip"); !exist {
+		t.Fatalf("dependent model not rebuilt, %s", user.Type())
+	}
+
+	write("email.json", `{"name":"email","fields":[{"name":"Address","type":"string"}]}`)
+
+	if got = next(); got["email"] != ModelAdded || len(got) != 1 {
+		t.Fatalf("expect email added, got %v", got)
+	}
+
+	if err = os.Remove(filepath.Join(dir, "email.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got = next(); got["email"] != ModelRemoved || len(got) != 1 {
+		t.Fatalf("expect email removed, got %v", got)
+	}
+
+	write("user.json", `{"name":"user","fields":[{"name":"Home","ref":"nope"}]}`)
+
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expect a reload error")
+	}
+
+	if user, _ = models.GetModel("user"); user == nil {
+		t.Fatal("failed reload should keep the current generation")
+	}
+
+	cancel()
+
+	for range events {
+	}
+}
+
+func TestWatchSameSizeRewrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "user.json")
+
+	if err := os.WriteFile(path, []byte(`{"name":"user","fields":[{"name":"Aa","type":"string"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	models, _ := NewModels()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := models.Watch(ctx, dir, WatchOptInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.WriteFile(path, []byte(`{"name":"user","fields":[{"name":"Bb","type":"string"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case event := <-events:
+		if event.Type != ModelUpdated || event.New.Type().Field(0).Name != "Bb" {
+			t.Fatalf("unexpected event %v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a rewrite keeping the size and the modification time is missed")
+	}
+}